@@ -2,62 +2,150 @@ package algo
 
 import (
 	"container/heap"
+	"context"
 	"fmt"
 	"github.com/shirou/gopsutil/v3/mem"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
+)
+
+// Nodes waiting in an outbox are sent to their owner once outboxSize of them
+// are pending, and every flushEvery expansions
+const (
+	outboxSize = 64
+	flushEvery = 256
 )
 
 func initData(param AlgoParameters) (data safeData) {
 	startPos := param.Board
-	data.SeenNodes = make([]map[uint64]int, param.SeenNodesSplit)
-	keyNode, _, _ := MatrixToStringSelector(startPos, param.Workers, param.SeenNodesSplit)
-	for i := 0; i < param.SeenNodesSplit; i++ {
-		data.SeenNodes[i] = make(map[uint64]int, 1000)
-		data.SeenNodes[i][keyNode] = 0
+	keyNode := BoardToState(startPos)
+	startH := 0
+	if param.Eval.Tiles != nil {
+		goalTable := NewGoalTable(Goal(len(startPos), param.Disposition))
+		startH = param.Eval.Tiles.Heuristic([]byte(keyNode), goalTable)
 	}
-	data.PosQueue = make([]*PriorityQueue, param.Workers)
-	for i := 0; i < param.Workers; i++ {
-
-		queue := make(PriorityQueue, 1, 1000)
-		queue[0] = &Item{node: Node{world: BoardToUint64(startPos), score: 0, path: []byte{}}}
-		data.PosQueue[i] = &queue
-		heap.Init(data.PosQueue[i])
+	data.Workers = make([]astarWorker, param.Workers)
+	for i := range data.Workers {
+		data.Workers[i].Seen = make(map[State]int, 1000)
+		data.Workers[i].Queue = make(PriorityQueue, 0, 1000)
 	}
-	data.Over = false
-	data.Win = false
-	data.MuQueue = make([]sync.Mutex, param.Workers)
-	data.MuSeen = make([]sync.Mutex, param.SeenNodesSplit)
-	data.MaxSizeQueue = make([]int, param.Workers)
-	data.Idle = 0
+	hash := zobristHash([]byte(keyNode))
+	root := Node{world: keyNode, hash: hash, score: 0, h: uint16(startH), empty: uint8(emptyCell([]byte(keyNode)))}
+	data.Workers[ownerOf(hash, param.Workers)].add(root)
+	data.Incumbent = 1<<32 - 1
+	data.RAMMin = minAvailableRAM(param.logger(), param.RAMMaxGB)
+	return
+}
+
+// Available RAM below which the search stops with a RAM failure
+func minAvailableRAM(logger Logger, ramMaxGB uint64) (ramMin uint64) {
 	currentAvailableRAM, _ := GetAvailableRAM()
-	if (param.RAMMaxGB << 30) < currentAvailableRAM {
-		data.RAMMin = currentAvailableRAM - (param.RAMMaxGB << 30)
-		fmt.Fprintln(os.Stderr, "RAM Min left for system is now :", data.RAMMin>>20, "MB")
+	if (ramMaxGB << 30) < currentAvailableRAM {
+		ramMin = currentAvailableRAM - (ramMaxGB << 30)
+		logger.Println("RAM Min left for system is now :", ramMin>>20, "MB")
 	} else {
-		fmt.Fprintf(os.Stderr, "Max Ram Usage specified (%d Mb) is superior to current available RAM (%d Mb). Ram failure will be triggered by fallback value (%d Mb)\n", param.RAMMaxGB<<10, currentAvailableRAM>>20, MinRAMAvailableMB)
-		data.RAMMin = 0
+		logger.Printf("Max Ram Usage specified (%d Mb) is superior to current available RAM (%d Mb). Ram failure will be triggered by fallback value (%d Mb)\n", ramMaxGB<<10, currentAvailableRAM>>20, MinRAMAvailableMB)
+	}
+	return ramMin
+}
+
+func ownerOf(hash uint64, workers int) int {
+	return int(hash % uint64(workers))
+}
+
+func (worker *astarWorker) add(node Node) {
+	if seenScore, alreadyExplored := worker.Seen[node.world]; alreadyExplored && int(node.score) >= seenScore {
+		return
+	}
+	worker.Seen[node.world] = int(node.score)
+	heap.Push(&worker.Queue, &Item{node: node})
+	worker.MaxSizeQueue = Max(worker.MaxSizeQueue, worker.Queue.Len())
+}
+
+// A worker is marked busy before counting what it takes from its inbox, so a
+// termination wave never sees it idle while holding received nodes
+func (worker *astarWorker) receive(buffer []Node) []Node {
+	worker.MuInbox.Lock()
+	if len(worker.Inbox) == 0 {
+		worker.MuInbox.Unlock()
+		return buffer[:0]
+	}
+	atomic.StoreInt32(&worker.Idle, 0)
+	received := worker.Inbox
+	worker.Inbox = buffer[:0]
+	worker.MuInbox.Unlock()
+	atomic.AddInt64(&worker.Received, int64(len(received)))
+	return received
+}
+
+// Nodes are counted as sent before they reach the inbox of their owner
+func (data *safeData) send(from *astarWorker, to int, nodes []Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	atomic.AddInt64(&from.Sent, int64(len(nodes)))
+	owner := &data.Workers[to]
+	owner.MuInbox.Lock()
+	owner.Inbox = append(owner.Inbox, nodes...)
+	owner.MuInbox.Unlock()
+}
+
+// Counting termination detection : the search is over when every worker was
+// idle during a first wave, and the nodes received counted in that wave
+// match the nodes sent counted in a second one. A node in flight was counted
+// as sent but not received, a worker that took nodes between the two waves
+// was busy in the first one or received them after its counter was read
+func detectTermination(ctx context.Context, data *safeData) {
+	for atomic.LoadInt32(&data.Over) == 0 && atomic.LoadInt32(&data.RamFailure) == 0 {
+		time.Sleep(200 * time.Microsecond)
+		if err := ctx.Err(); err != nil {
+			data.Interrupted = err
+			atomic.StoreInt32(&data.Over, 1)
+			return
+		}
+		received, allIdle := int64(0), true
+		for i := range data.Workers {
+			received += atomic.LoadInt64(&data.Workers[i].Received)
+			allIdle = allIdle && atomic.LoadInt32(&data.Workers[i].Idle) == 1
+		}
+		if !allIdle {
+			continue
+		}
+		sent := int64(0)
+		for i := range data.Workers {
+			sent += atomic.LoadInt64(&data.Workers[i].Sent)
+		}
+		if sent == received {
+			atomic.StoreInt32(&data.Over, 1)
+		}
 	}
-	return
 }
 
-func launchAstarWorkers(param AlgoParameters, data *safeData) (result Result) {
-	fmt.Fprintln(os.Stderr, "Selected ALGO : A*")
+func launchAstarWorkers(ctx context.Context, param AlgoParameters, data *safeData) (result Result) {
+	logger := param.logger()
+	logger.Println("Selected ALGO : A* (hash distributed)")
 	var wg sync.WaitGroup
 	for i := 0; i < param.Workers; i++ {
 		wg.Add(1)
 		go func(param AlgoParameters, data *safeData, i int) {
 
-			algo(param, data, i)
+			algo(ctx, param, data, i)
 			wg.Done()
 		}(param, data, i)
 	}
+	detectTermination(ctx, data)
 	wg.Wait()
 	min, max, indexmin, indexmax := 1<<31, 0, -1, -1
-	for index, value := range data.SeenNodes {
-		currLen := len(value)
+	createdNodes, maxFrontier := 0, 0
+	for index := range data.Workers {
+		worker := &data.Workers[index]
+		currLen := len(worker.Seen)
 		data.ClosedSetComplexity += currLen
+		data.Tries += worker.Tries
+		createdNodes += worker.CreatedNodes
+		maxFrontier += worker.MaxSizeQueue
 		if currLen > max {
 			max = currLen
 			indexmax = index
@@ -67,125 +155,136 @@ func launchAstarWorkers(param AlgoParameters, data *safeData) (result Result) {
 			indexmin = index
 		}
 	}
-	fmt.Fprintf(os.Stderr, "NodePool max count difference : %d k for [%d] - [%d]. Mean : %d k\n", (max-min)/1000, indexmax, indexmin, data.ClosedSetComplexity/(1000*len(data.SeenNodes)))
+	logger.Printf("NodePool max count difference : %d k for [%d] - [%d]. Mean : %d k\n", (max-min)/1000, indexmax, indexmin, data.ClosedSetComplexity/(1000*len(data.Workers)))
+	pathBytes := createdNodes * int(unsafe.Sizeof(pathNode{})+unsafe.Sizeof(&pathNode{}))
+	legacyBytes := legacyPathBytes(data.Workers, createdNodes)
+	logger.Printf("Path storage for %d nodes : %d KB with shared moves instead of about %d KB with a move slice per node (%d KB saved)\n", createdNodes, pathBytes>>10, legacyBytes>>10, (legacyBytes-pathBytes)>>10)
 	switch {
-	case data.Win == true:
-		fmt.Fprintln(os.Stderr, "Found a solution")
-	case data.RamFailure == true:
-		fmt.Fprintln(os.Stderr, "RAM Failure")
+	case data.Interrupted != nil:
+		logger.Println("Search interrupted :", data.Interrupted)
+		return Result{ClosedSetComplexity: data.ClosedSetComplexity, Tries: data.Tries, Algo: "A*", Interrupted: data.Interrupted, MaxFrontier: maxFrontier}
+	case data.RamFailure == 1:
+		logger.Println("RAM Failure")
+		return Result{ClosedSetComplexity: data.ClosedSetComplexity, Tries: data.Tries, RamFailure: true, Algo: "A*", MaxFrontier: maxFrontier}
+	case data.Win:
+		logger.Printf("\x1b[32mFound an OPTIMAL solution\n\x1b[0m")
 	}
-	return Result{data.Path, data.ClosedSetComplexity, data.Tries, data.RamFailure, "A*"}
+	return Result{Path: data.Path, ClosedSetComplexity: data.ClosedSetComplexity, Tries: data.Tries, Algo: "A*", Bound: param.Eval.Tiles.Bound(), MaxFrontier: maxFrontier}
 }
 
-func checkOptimalSolution(currentNode *Item, data *safeData) bool {
-	bestNodes := make([]*Item, len(data.PosQueue))
-	for i := range data.PosQueue {
-		data.MuQueue[i].Lock()
-		if data.PosQueue[i].Len() > 0 {
-			bestNodes[i] = heap.Pop(data.PosQueue[i]).(*Item)
-		} else {
-			bestNodes[i] = nil
-		}
-		data.MuQueue[i].Unlock()
+// Memory the paths of the created nodes would take with a move slice per
+// node, estimated from the mean depth of the expanded nodes
+func legacyPathBytes(workers []astarWorker, createdNodes int) int {
+	tries, depths := 0, 0
+	for i := range workers {
+		tries += workers[i].Tries
+		depths += workers[i].ExpandedDepths
 	}
-	//Check if at least one of the nodes has a score strictly inferior
-	for i := range bestNodes {
-		if bestNodes[i] != nil && bestNodes[i].node.score < currentNode.node.score {
-			for j := range bestNodes {
-				data.MuQueue[j].Lock()
-				if bestNodes[j] != nil {
-					heap.Push(data.PosQueue[j], bestNodes[j])
-				}
-				data.MuQueue[j].Unlock()
-			}
-			return false
-		}
+	if tries == 0 {
+		return 0
 	}
-
-	return true
+	return createdNodes * sliceBytes(depths/tries+1)
 }
 
-func algo(param AlgoParameters, data *safeData, workerIndex int) {
+// Popped nodes scoring at least as much as the best solution found so far are
+// dropped : once the search terminates, that solution is optimal
+func algo(ctx context.Context, param AlgoParameters, data *safeData, workerIndex int) {
+	worker := &data.Workers[workerIndex]
+	logger := param.logger()
 	goalPos := Goal(len(param.Board), param.Disposition)
+	goalState := BoardToState(goalPos)
+	goalTable := NewGoalTable(goalPos)
 	startPos := param.Board
-	var foundSol *Item
+	tiles := make([]byte, len(startPos)*len(startPos))
+	outbox := make([][]Node, param.Workers)
+	inbox := make([]Node, 0, outboxSize)
 	startAlgo := time.Now()
-	isIdle := false
 	for {
-		over, tries, lenqueue, idle, ramFailure := refreshData(data, workerIndex)
-		if ramFailure {
-			fmt.Fprintf(os.Stderr, "[%2d] - Someone had a ram failure. Leaving now\n", workerIndex)
+		if atomic.LoadInt32(&data.RamFailure) != 0 {
+			logger.Printf("[%2d] - Someone had a ram failure. Leaving now\n", workerIndex)
 			return
 		}
-		if over {
-			fmt.Fprintf(os.Stderr, "[%2d] - Someone ended sim. Leaving now\n", workerIndex)
+		if atomic.LoadInt32(&data.Over) != 0 {
+			logger.Printf("[%2d] - Search is over. Leaving now\n", workerIndex)
 			return
 		}
-		if idle >= param.Workers {
-			fmt.Fprintf(os.Stderr, "[%2d] - Everyone is idle\n", workerIndex)
-			return
+		inbox = worker.receive(inbox)
+		for _, node := range inbox {
+			worker.add(node)
 		}
-		if isIdle && lenqueue > 0 {
-			isIdle = false
-			data.Mu.Lock()
-			data.Idle--
-			data.Mu.Unlock()
+		if worker.Queue.Len() == 0 {
+			flushOutbox(data, worker, outbox, 0)
+			atomic.StoreInt32(&worker.Idle, 1)
+			time.Sleep(50 * time.Microsecond)
+			continue
 		}
-		if lenqueue == 0 {
-			if !isIdle {
-				data.Mu.Lock()
-				data.Idle++
-				data.Mu.Unlock()
-				isIdle = true
-			}
+		currentNode := heap.Pop(&worker.Queue).(*Item)
+		if uint32(currentNode.node.score) >= atomic.LoadUint32(&data.Incumbent) {
+			worker.Queue = worker.Queue[:0]
 			continue
 		}
-		currentNode := getNextNode(data, workerIndex)
-		if currentNode == nil {
+		if seenScore := worker.Seen[currentNode.node.world]; int(currentNode.node.score) > seenScore {
 			continue
 		}
-		if foundSol != nil && currentNode.node.score >= foundSol.node.score {
-			data.Mu.Lock()
-			fmt.Fprintf(os.Stderr, "\x1b[32m[%2d] - Found an OPTIMAL solution\n\x1b[0m", workerIndex)
-			terminateSearch(data, foundSol.node.path, foundSol.node.score)
-			data.Mu.Unlock()
+		worker.Tries++
+		worker.ExpandedDepths += int(currentNode.node.depth)
+		if worker.Tries%1024 == 0 && ctx.Err() != nil {
+			logger.Printf("[%2d] - Search was interrupted. Leaving now\n", workerIndex)
 			return
 		}
-		printInfo(workerIndex, tries, currentNode, startAlgo, lenqueue)
-		if isEqual(goalPos, Uint64ToBoard(currentNode.node.world, len(param.Board))) {
+		if worker.Tries%1024 == 0 {
+			worker.reportProgress(param.Progress, int(currentNode.node.score))
+		}
+		printInfo(logger, workerIndex, worker.Tries, currentNode, startAlgo, worker.Queue.Len())
+		if currentNode.node.world == goalState {
 			data.Mu.Lock()
-			if checkOptimalSolution(currentNode, data) {
-				fmt.Fprintf(os.Stderr, "\x1b[32m[%2d] - Found an OPTIMAL solution\n\x1b[0m", workerIndex)
-				terminateSearch(data, currentNode.node.path, currentNode.node.score)
-				data.Mu.Unlock()
-				return
-			} else {
-				fmt.Fprintf(os.Stderr, "\x1b[33m[%2d] - Found a solution : Caching result\n\x1b[0m", workerIndex)
-				foundSol = currentNode
-				data.Mu.Unlock()
+			if uint32(currentNode.node.score) < data.Incumbent {
+				logger.Printf("\x1b[33m[%2d] - Found a solution : Caching result\n\x1b[0m", workerIndex)
+				terminateSearch(data, currentNode.node.path.Moves(int(currentNode.node.depth)), currentNode.node.score)
 			}
+			data.Mu.Unlock()
+			continue
 		}
-		if tries%100000 == 0 {
+		if worker.Tries%100000 == 0 {
 			availableRAM, err := GetAvailableRAM()
 			if err != nil ||
 				availableRAM>>20 < MinRAMAvailableMB ||
 				availableRAM < data.RAMMin {
-				fmt.Fprintf(os.Stderr, "[%d] - Not enough RAM[%v MB] to continue or Fatal (error reading RAM status)\n", workerIndex, availableRAM>>20)
-				data.Mu.Lock()
-				data.RamFailure = true
-				data.Mu.Unlock()
+				logger.Printf("[%d] - Not enough RAM[%v MB] to continue or Fatal (error reading RAM status)\n", workerIndex, availableRAM>>20)
+				atomic.StoreInt32(&data.RamFailure, 1)
 				continue
 			}
 		}
-		getNextMoves(startPos, goalPos, param.Eval.Fx, currentNode.node.path, currentNode, data, workerIndex, param.Workers, param.SeenNodesSplit)
+		getNextMoves(startPos, goalPos, goalTable, param.Eval, currentNode, tiles, data, worker, workerIndex, outbox)
+		if worker.Tries%flushEvery == 0 {
+			flushOutbox(data, worker, outbox, 0)
+		} else {
+			flushOutbox(data, worker, outbox, outboxSize)
+		}
+	}
+}
+
+func (worker *astarWorker) reportProgress(counters *progressCounters, score int) {
+	counters.addNodes(1024)
+	counters.setBound(score)
+	counters.addSizes(worker.Queue.Len()-worker.ReportedOpen, len(worker.Seen)-worker.ReportedClosed)
+	worker.ReportedOpen, worker.ReportedClosed = worker.Queue.Len(), len(worker.Seen)
+}
+
+func flushOutbox(data *safeData, worker *astarWorker, outbox [][]Node, minimum int) {
+	for owner := range outbox {
+		if len(outbox[owner]) > 0 && len(outbox[owner]) >= minimum {
+			data.send(worker, owner, outbox[owner])
+			outbox[owner] = outbox[owner][:0]
+		}
 	}
 }
 
 func terminateSearch(data *safeData, solutionPath []byte, score uint16) {
 	data.Path = solutionPath
-	data.Over = true
 	data.Win = true
 	data.WinScore = score
+	atomic.StoreUint32(&data.Incumbent, uint32(score))
 }
 
 func GetAvailableRAM() (uint64, error) {
@@ -197,72 +296,56 @@ func GetAvailableRAM() (uint64, error) {
 	return availableRAM, nil
 }
 
-func addNodeToQueue(nextNode Node, queueIndex int, seenNodeIndex int, score int, keyNode uint64, data *safeData) {
-	item := &Item{node: nextNode}
-	data.MuQueue[queueIndex].Lock()
-	heap.Push(data.PosQueue[queueIndex], item)
-	data.MuQueue[queueIndex].Unlock()
-	data.MuSeen[seenNodeIndex].Lock()
-	data.SeenNodes[seenNodeIndex][keyNode] = score
-	data.MuSeen[seenNodeIndex].Unlock()
-}
-
-func createNextNode(nextPos [][]int, nextPath []byte, score int) Node {
-	return Node{world: BoardToUint64(nextPos), path: nextPath, score: uint16(score)}
+func createNextNode(nextState State, parent *Node, dir byte, score int, h int, empty int, hash uint64) Node {
+	nextPath := &pathNode{parent: parent.path, dir: dir}
+	return Node{world: nextState, hash: hash, path: nextPath, depth: parent.depth + 1, score: uint16(score), h: uint16(h), empty: uint8(empty)}
 }
 
-func getNextMoves(startPos, goalPos [][]int, scoreFx EvalFx, path []byte, currentNode *Item, data *safeData, index int, workers int, seenNodesSplit int) {
+// Children are built in the worker's tiles buffer : only the ones kept by
+// this worker or sent to their owner are allocated
+func getNextMoves(startPos, goalPos [][]int, goalTable *GoalTable, eval Eval, currentNode *Item, tiles []byte, data *safeData, worker *astarWorker, index int, outbox [][]Node) {
+	size := len(goalPos)
+	depth := int(currentNode.node.depth)
+	incumbent := atomic.LoadUint32(&data.Incumbent)
 	for _, dir := range Directions {
-		if len(path) > 0 {
-			conflictStr := string(path[len(path)-1]) + string(dir.name)
-			if conflictStr == "LR" || conflictStr == "RL" || conflictStr == "UD" || conflictStr == "DU" {
-				continue
-			}
+		if isReverseMove(currentNode.node.path.Last(), dir.name) {
+			continue
 		}
-		ok, nextPos := dir.fx(Uint64ToBoard(currentNode.node.world, len(goalPos)))
+		copy(tiles, currentNode.node.world)
+		empty := int(currentNode.node.empty)
+		next, ok := moveTiles(tiles, empty, dir.name, size)
 		if !ok {
 			continue
 		}
-		score := scoreFx(nextPos, startPos, goalPos, path)
-		nextPath := DeepSliceCopyAndAdd(path, dir.name)
-		nextNode := createNextNode(nextPos, nextPath, score)
-		keyNode, queueIndex, seenNodeIndex := MatrixToStringSelector(nextPos, workers, seenNodesSplit)
-		data.MuSeen[seenNodeIndex].Lock()
-		seenNodesScore, alreadyExplored := data.SeenNodes[seenNodeIndex][keyNode]
-		data.MuSeen[seenNodeIndex].Unlock()
-		if !alreadyExplored ||
-			score < seenNodesScore {
-			addNodeToQueue(nextNode, queueIndex, seenNodeIndex, score, keyNode, data)
+		var score, h int
+		if eval.Tiles != nil {
+			h = eval.Tiles.Update(int(currentNode.node.h), tiles, goalTable, tiles[empty], next, empty)
+			score = eval.Tiles.Score(depth, h)
+		} else {
+			score = eval.Fx(StateToBoard(State(tiles), size), startPos, goalPos, currentNode.node.path.Moves(depth))
+		}
+		if uint32(score) >= incumbent {
+			continue
+		}
+		hash := zobristUpdate(currentNode.node.hash, tiles[empty], next, empty)
+		owner := ownerOf(hash, len(outbox))
+		if owner == index {
+			if seenScore, alreadyExplored := worker.Seen[State(tiles)]; alreadyExplored && score >= seenScore {
+				continue
+			}
+		}
+		nextNode := createNextNode(State(tiles), &currentNode.node, dir.name, score, h, next, hash)
+		worker.CreatedNodes++
+		if owner == index {
+			worker.add(nextNode)
+		} else {
+			outbox[owner] = append(outbox[owner], nextNode)
 		}
 	}
 }
 
-func refreshData(data *safeData, workerIndex int) (over bool, tries, lenqueue int, idle int, ramFailure bool) {
-	data.Mu.Lock()
-	data.Tries++
-	tries = data.Tries
-	over = data.Over
-	idle = data.Idle
-	ramFailure = data.RamFailure
-	data.Mu.Unlock()
-	data.MuQueue[workerIndex].Lock()
-	lenqueue = len(*data.PosQueue[workerIndex])
-	data.MaxSizeQueue[workerIndex] = Max(data.MaxSizeQueue[workerIndex], lenqueue)
-	data.MuQueue[workerIndex].Unlock()
-	return
-}
-
-func printInfo(workerIndex int, tries int, currentNode *Item, startAlgo time.Time, lenqueue int) {
+func printInfo(logger Logger, workerIndex int, tries int, currentNode *Item, startAlgo time.Time, lenqueue int) {
 	if tries > 0 && tries%100000 == 0 {
-		fmt.Fprintf(os.Stderr, "[%2d] Time so far : %s | %d * 100k tries. Len of try : %d. Score : %d Len of Queue : %d\n", workerIndex, time.Since(startAlgo), tries/100000, len(currentNode.node.path), currentNode.node.score, lenqueue)
+		logger.Printf("[%2d] Time so far : %s | %d * 100k tries. Len of try : %d. Score : %d Len of Queue : %d\n", workerIndex, time.Since(startAlgo), tries/100000, currentNode.node.depth, currentNode.node.score, lenqueue)
 	}
 }
-
-func getNextNode(data *safeData, workerIndex int) (currentNode *Item) {
-	data.MuQueue[workerIndex].Lock()
-	if data.PosQueue[workerIndex].Len() != 0 {
-		currentNode = (heap.Pop(data.PosQueue[workerIndex])).(*Item)
-	}
-	data.MuQueue[workerIndex].Unlock()
-	return
-}
@@ -1,27 +1,50 @@
 package algo
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"sync/atomic"
 )
 
 func initDataIDA(param AlgoParameters) (data idaData) {
-	data.Goal = Goal(len(param.Board), param.Disposition)
-	data.MaxScore = param.Eval.Fx(param.Board, param.Board, data.Goal, []byte{})
-	data.States = append(data.States, Deep2DSliceCopy(param.Board))
-	hash, _, _ := MatrixToStringSelector(param.Board, 1, 1)
-	data.Hashes = append(data.Hashes, hash)
+	data.Size = len(param.Board)
+	data.Logger = param.logger()
+	data.Progress = param.Progress
+	data.Goal = Goal(data.Size, param.Disposition)
+	data.GoalState = BoardToState(data.Goal)
+	data.Board = []byte(BoardToState(param.Board))
+	data.Empty = emptyCell(data.Board)
+	data.Path = make([]byte, 0, 256)
+	data.Hashes = make([]uint64, 0, 256)
+	data.Hashes = append(data.Hashes, zobristHash(data.Board))
+	if param.TTShare > 0 {
+		data.Table = newTranspositionTable(uint64(float64(param.RAMMaxGB<<30) * param.TTShare))
+		data.Logger.Printf("Transposition table : %d entries (%d MB)\n", len(data.Table.entries), len(data.Table.entries)*16>>20)
+	}
 	data.Fx = param.Eval.Fx
+	data.Tiles = param.Eval.Tiles
+	if data.Tiles != nil {
+		data.GoalTable = NewGoalTable(data.Goal)
+		data.H = make([]int, 0, 256)
+		data.H = append(data.H, data.Tiles.Heuristic(data.Board, data.GoalTable))
+		data.MaxScore = data.Tiles.Score(0, data.H[0])
+	} else {
+		data.MaxScore = param.Eval.Fx(param.Board, param.Board, data.Goal, []byte{})
+	}
 	return
 }
 
-func iterateIDA(data *idaData) (result Result) {
-	fmt.Fprintln(os.Stderr, "Selected ALGO : IDA*")
+func iterateIDA(ctx context.Context, data *idaData) (result Result) {
+	data.Logger.Println("Selected ALGO : IDA*")
 	for data.MaxScore < 1<<30 {
-		fmt.Fprintln(os.Stderr, "Cut off is now :", data.MaxScore)
-		newMaxScore, found := ida(data)
+		data.Logger.Println("Cut off is now :", data.MaxScore)
+		data.Progress.setBound(data.MaxScore)
+		newMaxScore, found := ida(ctx, data)
 		if found {
-			return Result{data.Path, data.ClosedSetComplexity, data.Tries, data.RamFailure, "IDA"}
+			return Result{Path: data.Path, ClosedSetComplexity: data.ClosedSetComplexity, Tries: data.Tries, RamFailure: data.RamFailure, Algo: "IDA", Bound: data.Tiles.Bound(), MaxFrontier: data.ClosedSetComplexity}
+		}
+		if data.Interrupted != nil {
+			data.Logger.Println("Search interrupted :", data.Interrupted)
+			return Result{ClosedSetComplexity: data.ClosedSetComplexity, Tries: data.Tries, Algo: "IDA", Interrupted: data.Interrupted, MaxFrontier: data.ClosedSetComplexity}
 		}
 		data.MaxScore = newMaxScore
 	}
@@ -29,43 +52,66 @@ func iterateIDA(data *idaData) (result Result) {
 	return
 }
 
-func ida(data *idaData) (newMaxScore int, found bool) {
-	currentState := data.States[len(data.States)-1]
-	score := data.Fx(currentState, data.States[0], data.Goal, data.Path)
+// Once interrupted, the search unwinds without expanding anything else
+func ida(ctx context.Context, data *idaData) (newMaxScore int, found bool) {
+	if data.Interrupted != nil || (data.Stop != nil && atomic.LoadInt32(data.Stop) != 0) {
+		return 1 << 30, false
+	}
+	var score int
+	if data.Tiles != nil {
+		score = data.Tiles.Score(len(data.Path), data.H[len(data.H)-1])
+	} else {
+		score = data.Fx(StateToBoard(State(data.Board), data.Size), nil, data.Goal, data.Path)
+	}
 	data.Tries++
+	if data.Tries%4096 == 0 && ctx.Err() != nil {
+		data.Interrupted = ctx.Err()
+		return 1 << 30, false
+	}
+	if data.Tries%4096 == 0 {
+		data.Progress.addNodes(4096)
+		data.Progress.setSizes(len(data.Path), 0)
+	}
 	if data.Tries > 0 && data.Tries%100000 == 0 {
-		fmt.Fprintf(os.Stderr, "%d * 100k tries\n", data.Tries/100000)
+		data.Logger.Printf("%d * 100k tries\n", data.Tries/100000)
 	}
-	if currentComplexity := len(data.States); currentComplexity > data.ClosedSetComplexity {
+	if currentComplexity := len(data.Hashes); currentComplexity > data.ClosedSetComplexity {
 		data.ClosedSetComplexity = currentComplexity
 	}
 	if score > data.MaxScore {
 		return score, false
 	}
-	if isEqual(currentState, data.Goal) {
+	if string(data.Board) == string(data.GoalState) {
 		return -1, true
 	}
+	if data.Table != nil && !data.Table.visit(data.Hashes[len(data.Hashes)-1], len(data.Path), data.MaxScore) {
+		return 1 << 30, false
+	}
 	minScoreAboveCutOff := 1 << 30
+	hash := data.Hashes[len(data.Hashes)-1]
 	for _, dir := range Directions {
-		if len(data.Path) > 0 {
-			conflictStr := string(data.Path[len(data.Path)-1]) + string(dir.name)
-			if conflictStr == "LR" || conflictStr == "RL" || conflictStr == "UD" || conflictStr == "DU" {
-				continue
-			}
+		if len(data.Path) > 0 && isReverseMove(data.Path[len(data.Path)-1], dir.name) {
+			continue
 		}
-		ok, nextPos := dir.fx(currentState)
+		empty := data.Empty
+		next, ok := moveTiles(data.Board, empty, dir.name, data.Size)
 		if !ok {
 			continue
 		}
-		nextHash, _, _ := MatrixToStringSelector(nextPos, 1, 1)
+		tile := data.Board[empty]
+		nextHash := zobristUpdate(hash, tile, next, empty)
 		if index := Index(data.Hashes, nextHash); index != -1 {
+			moveTiles(data.Board, next, reverseMove(dir.name), data.Size)
 			continue
 		}
+		if data.Tiles != nil {
+			data.H = append(data.H, data.Tiles.Update(data.H[len(data.H)-1], data.Board, data.GoalTable, tile, next, empty))
+		}
+		data.Empty = next
 		data.Path = append(data.Path, dir.name)
-		data.States = append(data.States, nextPos)
 		data.Hashes = append(data.Hashes, nextHash)
 
-		newMaxScore, found := ida(data)
+		newMaxScore, found := ida(ctx, data)
 		if found {
 			return newMaxScore, true
 		}
@@ -73,8 +119,12 @@ func ida(data *idaData) (newMaxScore int, found bool) {
 			minScoreAboveCutOff = newMaxScore
 		}
 		data.Path = data.Path[:len(data.Path)-1]
-		data.States = data.States[:len(data.States)-1]
 		data.Hashes = data.Hashes[:len(data.Hashes)-1]
+		if data.Tiles != nil {
+			data.H = data.H[:len(data.H)-1]
+		}
+		moveTiles(data.Board, next, reverseMove(dir.name), data.Size)
+		data.Empty = empty
 	}
 	return minScoreAboveCutOff, false
 }
@@ -0,0 +1,267 @@
+package algo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelAstarOptimal(t *testing.T) {
+	eval := evalByName(t, "astar_manhattan_conflict")
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for _, workers := range []int{1, 4} {
+			for i := 0; i < 10; i++ {
+				board := GridGenerator(3, disposition)
+				param := AlgoParameters{Board: board, Disposition: disposition, Eval: eval, Workers: workers, RAMMaxGB: 1}
+				data := initData(param)
+				result := launchAstarWorkers(context.Background(), param, &data)
+				dataIDA := initDataIDA(param)
+				optimal := iterateIDA(context.Background(), &dataIDA)
+				if len(result.Path) != len(optimal.Path) {
+					t.Errorf("[%s %d workers] A* found %d moves for %v, IDA* found %d", disposition, workers, len(result.Path), board, len(optimal.Path))
+				}
+			}
+		}
+	}
+}
+
+func TestParallelIDAOptimal(t *testing.T) {
+	eval := evalByName(t, "astar_manhattan_conflict")
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for i := 0; i < 10; i++ {
+			board := GridGenerator(3, disposition)
+			param := AlgoParameters{Board: board, Disposition: disposition, Eval: eval, Workers: 4, RAMMaxGB: 1, TTShare: float64(i%2) / 100}
+			result := launchIDAWorkers(context.Background(), param)
+			param.TTShare = 0
+			data := initDataIDA(param)
+			optimal := iterateIDA(context.Background(), &data)
+			if len(result.Path) != len(optimal.Path) || !isSolution(board, result.Path, disposition) {
+				t.Errorf("[%s] parallel IDA* found %q for %v, IDA* found %d moves", disposition, result.Path, board, len(optimal.Path))
+			}
+		}
+	}
+}
+
+func isSolution(board [][]int, path []byte, disposition string) bool {
+	tiles := []byte(BoardToState(board))
+	empty := emptyCell(tiles)
+	for _, dir := range path {
+		next, ok := moveTiles(tiles, empty, dir, len(board))
+		if !ok {
+			return false
+		}
+		empty = next
+	}
+	return State(tiles) == BoardToState(Goal(len(board), disposition))
+}
+
+func TestTranspositionTable(t *testing.T) {
+	eval := evalByName(t, "astar_manhattan_conflict")
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for i := 0; i < 10; i++ {
+			board := GridGenerator(3, disposition)
+			param := AlgoParameters{Board: board, Disposition: disposition, Eval: eval}
+			data := initDataIDA(param)
+			optimal := iterateIDA(context.Background(), &data)
+			data = initDataIDA(param)
+			data.Table = newTranspositionTable(1 << 16)
+			result := iterateIDA(context.Background(), &data)
+			if len(result.Path) != len(optimal.Path) || !isSolution(board, result.Path, disposition) {
+				t.Errorf("[%s] IDA* with a transposition table found %q for %v, IDA* found %d moves", disposition, result.Path, board, len(optimal.Path))
+			}
+			if result.Tries > optimal.Tries {
+				t.Errorf("[%s] IDA* with a transposition table made %d tries for %v, IDA* made %d", disposition, result.Tries, board, optimal.Tries)
+			}
+		}
+	}
+}
+
+func TestBidirectionalOptimal(t *testing.T) {
+	eval := evalByName(t, "astar_manhattan_conflict")
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for i := 0; i < 10; i++ {
+			board := GridGenerator(3, disposition)
+			param := AlgoParameters{Board: board, Disposition: disposition, Eval: eval, RAMMaxGB: 1}
+			result := launchBidirectional(context.Background(), param)
+			data := initDataIDA(param)
+			optimal := iterateIDA(context.Background(), &data)
+			if len(result.Path) != len(optimal.Path) || !isSolution(board, result.Path, disposition) {
+				t.Errorf("[%s] bidirectional search found %q for %v, IDA* found %d moves", disposition, result.Path, board, len(optimal.Path))
+			}
+		}
+		param := AlgoParameters{Board: Goal(3, disposition), Disposition: disposition, Eval: eval, RAMMaxGB: 1}
+		if result := launchBidirectional(context.Background(), param); result.Path == nil || len(result.Path) != 0 {
+			t.Errorf("[%s] bidirectional search found %q for the goal", disposition, result.Path)
+		}
+	}
+}
+
+func TestBoundedSuboptimal(t *testing.T) {
+	eval := evalByName(t, "astar_manhattan_conflict")
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for i := 0; i < 10; i++ {
+			board := GridGenerator(3, disposition)
+			param := AlgoParameters{Board: board, Disposition: disposition, Eval: eval, Workers: 2, RAMMaxGB: 1, Epsilon: 2}
+			data := initDataIDA(param)
+			optimal := len(iterateIDA(context.Background(), &data).Path)
+			ara := launchARAStar(context.Background(), param)
+			if len(ara.Path) != optimal || ara.Bound != 1 || !isSolution(board, ara.Path, disposition) {
+				t.Errorf("[%s] ARA* found %q with bound %.2f for %v, IDA* found %d moves", disposition, ara.Path, ara.Bound, board, optimal)
+			}
+			param.Eval.Tiles = eval.Tiles.Inflate(param.Epsilon)
+			astarData := initData(param)
+			weighted := launchAstarWorkers(context.Background(), param, &astarData)
+			if weighted.Bound != 2 || float64(len(weighted.Path)) > weighted.Bound*float64(optimal) || !isSolution(board, weighted.Path, disposition) {
+				t.Errorf("[%s] weighted A* found %q with bound %.2f for %v, IDA* found %d moves", disposition, weighted.Path, weighted.Bound, board, optimal)
+			}
+		}
+	}
+}
+
+// Solutions found before the workers start keep the bound of the scoring
+func TestParallelIDAEarlyBound(t *testing.T) {
+	eval := evalByName(t, "astar_manhattan_conflict")
+	eval.Tiles = eval.Tiles.Inflate(2)
+	goal := Goal(3, "zerolast")
+	for _, board := range [][][]int{goal, {{1, 2, 3}, {4, 5, 6}, {7, 0, 8}}} {
+		param := AlgoParameters{Board: board, Disposition: "zerolast", Eval: eval, Workers: 4, RAMMaxGB: 1}
+		if result := launchIDAWorkers(context.Background(), param); result.Bound != 2 || !isSolution(board, result.Path, "zerolast") {
+			t.Errorf("Parallel IDA* found %q with bound %.2f for %v", result.Path, result.Bound, board)
+		}
+	}
+}
+
+func TestSolveInterrupted(t *testing.T) {
+	board := [][]int{{5, 7, 15, 1}, {2, 14, 10, 11}, {12, 13, 8, 9}, {4, 6, 0, 3}}
+	param := AlgoParameters{Board: board, Disposition: "snail", Eval: evalByName(t, "astar_manhattan_conflict"), Workers: 4, RAMMaxGB: 1}
+	solvers := map[string]func(ctx context.Context) Result{
+		"A*": func(ctx context.Context) Result {
+			data := initData(param)
+			return launchAstarWorkers(ctx, param, &data)
+		},
+		"IDA*":   func(ctx context.Context) Result { data := initDataIDA(param); return iterateIDA(ctx, &data) },
+		"IDA* 4": func(ctx context.Context) Result { return launchIDAWorkers(ctx, param) },
+		"MM":     func(ctx context.Context) Result { return launchBidirectional(ctx, param) },
+		"ARA*":   func(ctx context.Context) Result { return launchARAStar(ctx, param) },
+	}
+	for name, solve := range solvers {
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		if result := solve(cancelled); result.Path != nil || result.Interrupted != context.Canceled {
+			t.Errorf("[%s] cancelled search returned %q with %v", name, result.Path, result.Interrupted)
+		}
+		if name == "ARA*" {
+			continue
+		}
+		timeout, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		result := solve(timeout)
+		cancel()
+		if result.Path != nil || result.Interrupted != context.DeadlineExceeded || time.Since(start) > time.Second {
+			t.Errorf("[%s] search with a timeout returned %q with %v after %s", name, result.Path, result.Interrupted, time.Since(start))
+		}
+	}
+}
+
+type countingLogger struct {
+	lines int32
+}
+
+func (logger *countingLogger) Printf(format string, v ...any) { atomic.AddInt32(&logger.lines, 1) }
+
+func (logger *countingLogger) Println(v ...any) { atomic.AddInt32(&logger.lines, 1) }
+
+func TestBidirectionalHeuristics(t *testing.T) {
+	Evals = append(Evals, Eval{Name: "fx_only", Fx: greedy_manhattan})
+	defer func() { Evals = Evals[:len(Evals)-1] }()
+	test := []struct {
+		heuristic string
+		epsilon   float64
+		want      SolveStatus
+	}{
+		{"astar_manhattan_conflict", 1, StatusOK},
+		{"astar_manhattan_conflict", 2, StatusInvalidParam},
+		{"astar_manhattan2", 1, StatusInvalidParam},
+		{"greedy_manhattan", 1, StatusInvalidParam},
+		{"astar_walking_distance", 1, StatusInvalidParam},
+		{"fx_only", 1, StatusInvalidParam},
+	}
+	for _, test := range test {
+		opt := Option{StringInput: "3 8 6 7 2 5 4 3 0 1", Algo: "bidir", Heuristic: test.heuristic, Workers: 1, SeenNodesSplit: 1, RAMMaxGB: 1, Disposition: "zerolast", Epsilon: test.epsilon}
+		if outcome, _ := NewSolver(opt).Solve(context.Background()); outcome.Status != test.want {
+			t.Errorf("[%s %.1f] bidirectional solve returned %v", test.heuristic, test.epsilon, outcome)
+		}
+	}
+}
+
+func TestWeightedHeuristics(t *testing.T) {
+	Evals = append(Evals, Eval{Name: "fx_only", Fx: greedy_manhattan})
+	defer func() { Evals = Evals[:len(Evals)-1] }()
+	test := []struct {
+		algo      string
+		heuristic string
+		epsilon   float64
+		want      SolveStatus
+	}{
+		{"arastar", "astar_manhattan_conflict", 2, StatusOK},
+		{"arastar", "astar_manhattan2", 2, StatusInvalidParam},
+		{"arastar", "greedy_manhattan", 2, StatusInvalidParam},
+		{"arastar", "fx_only", 2, StatusInvalidParam},
+		{"astar", "fx_only", 1, StatusOK},
+		{"astar", "fx_only", 2, StatusInvalidParam},
+		{"ida", "fx_only", 2, StatusInvalidParam},
+	}
+	for _, test := range test {
+		opt := Option{StringInput: "3 8 6 7 2 5 4 3 0 1", Algo: test.algo, Heuristic: test.heuristic, Workers: 1, SeenNodesSplit: 1, RAMMaxGB: 1, Disposition: "zerolast", Epsilon: test.epsilon}
+		if outcome, _ := NewSolver(opt).Solve(context.Background()); outcome.Status != test.want {
+			t.Errorf("[%s %s %.1f] solve returned %v", test.algo, test.heuristic, test.epsilon, outcome)
+		}
+	}
+}
+
+func TestConcurrentSolvers(t *testing.T) {
+	algos := []string{"astar", "ida", "bidir", "arastar", "ida", "astar"}
+	loggers := make([]countingLogger, len(algos))
+	var wg sync.WaitGroup
+	for i, name := range algos {
+		disposition := []string{"snail", "zerolast"}[i%2]
+		board := GridGenerator(3, disposition)
+		opt := Option{StringInput: "3 " + MatrixToStringHashOnly(board, " "), Algo: name, Heuristic: "astar_manhattan_conflict", Workers: 2, SeenNodesSplit: 1, RAMMaxGB: 1, Disposition: disposition, Epsilon: 1}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			outcome, solution := NewSolver(opt, WithLogger(&loggers[i])).Solve(context.Background())
+			if outcome.Status != StatusOK || solution == nil || !isSolution(board, outcome.Moves, disposition) {
+				t.Errorf("[%s] concurrent solve of %v returned %v", name, board, outcome)
+			}
+			if atomic.LoadInt32(&loggers[i].lines) == 0 {
+				t.Errorf("[%s] solver did not write to its logger", name)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+}
+
+func TestSolverProgress(t *testing.T) {
+	for _, name := range []string{"astar", "ida", "bidir", "arastar"} {
+		var snapshots []Progress
+		opt := Option{StringInput: "3 8 6 7 2 5 4 3 0 1", Algo: name, Heuristic: "astar_manhattan", Workers: 1, SeenNodesSplit: 1, RAMMaxGB: 1, Disposition: "zerolast", Epsilon: 1}
+		outcome, _ := NewSolver(opt, WithProgress(time.Millisecond, func(progress Progress) {
+			snapshots = append(snapshots, progress)
+		})).Solve(context.Background())
+		if outcome.Status != StatusOK || len(snapshots) == 0 {
+			t.Fatalf("[%s] solve returned %v with %d snapshots", name, outcome, len(snapshots))
+		}
+		last := snapshots[len(snapshots)-1]
+		if !last.Done || last.Nodes != outcome.Nodes {
+			t.Errorf("[%s] last snapshot %+v does not match %v", name, last, outcome)
+		}
+		for i := 1; i < len(snapshots); i++ {
+			if snapshots[i].Nodes < snapshots[i-1].Nodes || snapshots[i].Elapsed < snapshots[i-1].Elapsed || snapshots[i-1].Done {
+				t.Errorf("[%s] snapshot %+v follows %+v", name, snapshots[i], snapshots[i-1])
+			}
+		}
+	}
+}
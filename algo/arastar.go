@@ -0,0 +1,214 @@
+package algo
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Anytime Repairing A* : weighted A* searches with a decreasing epsilon, each
+// one keeping the depths found by the previous ones. A state reached again
+// with a lower depth after its expansion waits in Incons for the next search.
+// The heuristic parts are used with epsilon as their weight : setParam only
+// lets through heuristics of weight 1
+type araData struct {
+	Tiles     *TileEval
+	GoalTable *GoalTable
+	GoalState State
+	Size      int
+	Nodes     map[State]Node
+	Open      PriorityQueue
+	Closed    map[State]bool
+	Incons    []State
+	Solution  *Node
+	RAMMin    uint64
+	Tries     int
+	MaxOpen   int
+	Logger    Logger
+	Progress  *progressCounters
+}
+
+func initDataARA(param AlgoParameters, epsilon float64) (data araData) {
+	data.Size = len(param.Board)
+	goal := Goal(data.Size, param.Disposition)
+	data.GoalState = BoardToState(goal)
+	data.GoalTable = NewGoalTable(goal)
+	data.Tiles = tileEvalGenerator(1, false, param.Eval.Tiles.Parts...)
+	data.Nodes = make(map[State]Node, 1000)
+	data.Closed = make(map[State]bool, 1000)
+	data.Logger = param.logger()
+	data.Progress = param.Progress
+	data.RAMMin = minAvailableRAM(data.Logger, param.RAMMaxGB)
+	start := BoardToState(param.Board)
+	h := data.Tiles.Heuristic([]byte(start), data.GoalTable)
+	root := Node{world: start, score: uint16(data.Tiles.Inflate(epsilon).Score(0, h)), h: uint16(h), empty: uint8(emptyCell([]byte(start)))}
+	data.Nodes[start] = root
+	data.Open = PriorityQueue{&Item{node: root}}
+	if start == data.GoalState {
+		data.Solution = &root
+	}
+	return
+}
+
+// Expands states until none may lead to a solution shorter than epsilon times
+// the current one. Stops early on a RAM failure or an interruption, or once
+// the deadline is passed if a solution was already found. An interruption is
+// only an error until a solution is found
+func (data *araData) improvePath(ctx context.Context, epsilon float64, deadline time.Time) (stopped bool, err error) {
+	logger := data.Logger
+	weighted := data.Tiles.Inflate(epsilon)
+	buffer := make([]byte, data.Size*data.Size)
+	for data.Open.Len() > 0 {
+		if data.Solution != nil && int(data.Open[0].node.score) >= weighted.Score(int(data.Solution.depth), 0) {
+			return false, nil
+		}
+		// Checked before popping, so that every state left to expand is
+		// still in Open for the bound
+		if data.Tries%1024 == 0 && ctx.Err() != nil && data.Solution == nil {
+			return true, ctx.Err()
+		}
+		if data.Tries%1024 == 0 && data.Solution != nil && (ctx.Err() != nil || (!deadline.IsZero() && time.Now().After(deadline))) {
+			return true, nil
+		}
+		if data.Tries > 0 && data.Tries%100000 == 0 {
+			availableRAM, err := GetAvailableRAM()
+			if err != nil || availableRAM>>20 < MinRAMAvailableMB || availableRAM < data.RAMMin {
+				return true, fmt.Errorf("Not enough RAM[%v MB] to continue or Fatal (error reading RAM status)", availableRAM>>20)
+			}
+		}
+		item := heap.Pop(&data.Open).(*Item)
+		node := item.node
+		if data.Nodes[node.world].depth < node.depth || data.Closed[node.world] {
+			continue
+		}
+		data.Closed[node.world] = true
+		data.Tries++
+		if data.Tries%1024 == 0 {
+			data.Progress.addNodes(1024)
+			data.Progress.setBound(int(node.score))
+			data.Progress.setSizes(data.Open.Len(), len(data.Closed))
+		}
+		if data.Tries%100000 == 0 {
+			logger.Printf("%d * 100k tries. Epsilon : %.2f. Score : %d\n", data.Tries/100000, epsilon, node.score)
+		}
+		for _, dir := range Directions {
+			if isReverseMove(node.path.Last(), dir.name) {
+				continue
+			}
+			copy(buffer, node.world)
+			empty := int(node.empty)
+			next, ok := moveTiles(buffer, empty, dir.name, data.Size)
+			if !ok {
+				continue
+			}
+			depth := int(node.depth) + 1
+			if seen, ok := data.Nodes[State(buffer)]; ok && int(seen.depth) <= depth {
+				continue
+			}
+			h := data.Tiles.Update(int(node.h), buffer, data.GoalTable, buffer[empty], next, empty)
+			child := Node{world: State(buffer), path: &pathNode{parent: node.path, dir: dir.name}, depth: uint16(depth), score: uint16(weighted.Score(depth, h)), h: uint16(h), empty: uint8(next)}
+			data.Nodes[child.world] = child
+			if child.world == data.GoalState {
+				data.Solution = &child
+			}
+			if data.Closed[child.world] {
+				data.Incons = append(data.Incons, child.world)
+			} else {
+				heap.Push(&data.Open, &Item{node: child})
+				data.MaxOpen = Max(data.MaxOpen, data.Open.Len())
+			}
+		}
+	}
+	return false, nil
+}
+
+// The optimal solution goes through a state of Open or Incons reached with
+// its optimal depth, so no solution is shorter than their lowest depth plus
+// heuristic
+func (data *araData) bound() float64 {
+	lowest := math.MaxInt
+	for _, item := range data.Open {
+		node := data.Nodes[item.node.world]
+		lowest = Min(lowest, int(node.depth)+int(node.h))
+	}
+	for _, state := range data.Incons {
+		node := data.Nodes[state]
+		lowest = Min(lowest, int(node.depth)+int(node.h))
+	}
+	if lowest == math.MaxInt || int(data.Solution.depth) <= lowest {
+		return 1
+	}
+	return float64(data.Solution.depth) / float64(lowest)
+}
+
+// Next search : Incons goes back to Open, scored with the new epsilon
+func (data *araData) repair(epsilon float64) {
+	weighted := data.Tiles.Inflate(epsilon)
+	states := data.Incons
+	for _, item := range data.Open {
+		states = append(states, item.node.world)
+	}
+	data.Open = data.Open[:0]
+	data.Incons = nil
+	data.Closed = make(map[State]bool, len(data.Closed))
+	queued := make(map[State]bool, len(states))
+	for _, state := range states {
+		if queued[state] {
+			continue
+		}
+		queued[state] = true
+		node := data.Nodes[state]
+		node.score = uint16(weighted.Score(int(node.depth), int(node.h)))
+		data.Open = append(data.Open, &Item{node: node})
+	}
+	heap.Init(&data.Open)
+}
+
+func launchARAStar(ctx context.Context, param AlgoParameters) (result Result) {
+	logger := param.logger()
+	epsilon := param.Epsilon
+	logger.Printf("Selected ALGO : ARA* (epsilon %.2f, deadline %s)\n", epsilon, param.Deadline)
+	var deadline time.Time
+	if param.Deadline > 0 {
+		deadline = time.Now().Add(param.Deadline)
+	}
+	data := initDataARA(param, epsilon)
+	result.Algo = "ARA*"
+	for {
+		tries := data.Tries
+		stopped, err := data.improvePath(ctx, epsilon, deadline)
+		result.Tries, result.ClosedSetComplexity, result.MaxFrontier = data.Tries, len(data.Nodes), data.MaxOpen
+		if err != nil && ctx.Err() != nil {
+			logger.Println("Search interrupted :", err)
+			result.Interrupted = err
+			return
+		}
+		if err != nil {
+			logger.Println(err)
+			result.RamFailure = data.Solution == nil
+			stopped = true
+		}
+		if data.Solution == nil {
+			return
+		}
+		// Epsilon only bounds the solution of a completed search, and a bound
+		// of a previous solution still holds for a shorter one
+		bound := data.bound()
+		if !stopped {
+			bound = math.Min(epsilon, bound)
+		}
+		if result.Bound > 0 {
+			bound = math.Min(result.Bound, bound)
+		}
+		result.Path = data.Solution.path.Moves(int(data.Solution.depth))
+		result.Bound = bound
+		logger.Printf("Solution of %d moves with epsilon %.2f : at most %.2f times the optimal length\n", len(result.Path), epsilon, result.Bound)
+		if stopped || result.Bound <= 1 || (epsilon == 1 && tries == data.Tries) {
+			return
+		}
+		epsilon = math.Max(1, math.Min(epsilon, result.Bound)-0.5)
+		data.repair(epsilon)
+	}
+}
@@ -0,0 +1,80 @@
+package algo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var benchBoard = [][]int{{1, 2, 4, 5}, {9, 10, 14, 3}, {12, 15, 13, 6}, {7, 0, 8, 11}}
+
+func reportNodesPerSecond(b *testing.B, nodes int, start time.Time) {
+	b.ReportMetric(float64(nodes)/time.Since(start).Seconds(), "nodes/s")
+}
+
+// Expansion as done before packed moves : decode the state, copy the board for
+// every move and evaluate the children from scratch
+func BenchmarkExpandBoard(b *testing.B) {
+	goal := Goal(4, "snail")
+	fx := astar_manhattan_generator_conflict(1)
+	state := BoardToState(benchBoard)
+	nodes := 0
+	b.ReportAllocs()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		board := StateToBoard(state, 4)
+		for _, dir := range Directions {
+			ok, nextPos := dir.fx(board)
+			if !ok {
+				continue
+			}
+			fx(nextPos, board, goal, nil)
+			BoardToState(nextPos)
+			nodes++
+		}
+	}
+	reportNodesPerSecond(b, nodes, start)
+}
+
+func BenchmarkExpandPacked(b *testing.B) {
+	goalTable := NewGoalTable(Goal(4, "snail"))
+	eval := tileEvalGenerator(1, false, manhattanHeuristic, conflictHeuristic)
+	state := BoardToState(benchBoard)
+	tiles := make([]byte, len(state))
+	h := eval.Heuristic([]byte(state), goalTable)
+	empty := emptyCell([]byte(state))
+	nodes := 0
+	b.ReportAllocs()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for _, dir := range Directions {
+			copy(tiles, state)
+			next, ok := moveTiles(tiles, empty, dir.name, 4)
+			if !ok {
+				continue
+			}
+			eval.Score(0, eval.Update(h, tiles, goalTable, tiles[empty], next, empty))
+			zobristUpdate(0, tiles[empty], next, empty)
+			nodes++
+		}
+	}
+	reportNodesPerSecond(b, nodes, start)
+}
+
+func BenchmarkIDA(b *testing.B) {
+	eval := Eval{}
+	for _, current := range Evals {
+		if current.Name == "astar_manhattan_conflict" {
+			eval = current
+		}
+	}
+	nodes := 0
+	b.ReportAllocs()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		data := initDataIDA(AlgoParameters{Board: benchBoard, Disposition: "snail", Eval: eval})
+		result := iterateIDA(context.Background(), &data)
+		nodes += result.Tries
+	}
+	reportNodesPerSecond(b, nodes, start)
+}
@@ -0,0 +1,129 @@
+package algo
+
+import (
+	"container/heap"
+	"context"
+)
+
+// One direction of the bidirectional search. Its heuristic is measured
+// against the board the other direction starts from
+type bidirSide struct {
+	Queue  PriorityQueue
+	Seen   map[State]Node
+	Target *GoalTable
+}
+
+func newBidirSide(start State, target [][]int, tiles *TileEval) (side bidirSide) {
+	side.Target = NewGoalTable(target)
+	side.Seen = make(map[State]Node, 1000)
+	h := tiles.Heuristic([]byte(start), side.Target)
+	root := Node{world: start, score: uint16(mmPriority(tiles, 0, h)), h: uint16(h), empty: uint8(emptyCell([]byte(start)))}
+	side.Seen[start] = root
+	side.Queue = PriorityQueue{&Item{node: root}}
+	return
+}
+
+// MM priority : a node is not expanded before half of the cost of any
+// solution going through it, so both directions meet in the middle
+func mmPriority(tiles *TileEval, depth int, h int) int {
+	return Max(tiles.Score(depth, h), 2*depth+1)
+}
+
+// Forward moves of the backward half : the empty tile retraces the backward
+// path from the meeting board to the goal
+func joinPaths(forward, backward []byte) (path []byte) {
+	path = make([]byte, 0, len(forward)+len(backward))
+	path = append(path, forward...)
+	for i := len(backward) - 1; i >= 0; i-- {
+		path = append(path, reverseMove(backward[i]))
+	}
+	return path
+}
+
+func launchBidirectional(ctx context.Context, param AlgoParameters) (result Result) {
+	logger := param.logger()
+	logger.Println("Selected ALGO : Bidirectional MM")
+	size := len(param.Board)
+	tiles := param.Eval.Tiles
+	goal := Goal(size, param.Disposition)
+	sides := [2]bidirSide{
+		newBidirSide(BoardToState(param.Board), goal, tiles),
+		newBidirSide(BoardToState(goal), param.Board, tiles),
+	}
+	ramMin := minAvailableRAM(logger, param.RAMMaxGB)
+	best, meeting := 1<<30, State("")
+	if _, ok := sides[1].Seen[BoardToState(param.Board)]; ok {
+		best, meeting = 0, BoardToState(param.Board)
+	}
+	buffer := make([]byte, size*size)
+	for sides[0].Queue.Len() > 0 && sides[1].Queue.Len() > 0 {
+		current := 0
+		if sides[1].Queue[0].node.score < sides[0].Queue[0].node.score {
+			current = 1
+		}
+		// Priorities are the solution cost plus one, and no solution cheaper
+		// than the lowest priority is left to find
+		if best+1 <= int(sides[current].Queue[0].node.score) {
+			break
+		}
+		result.MaxFrontier = Max(result.MaxFrontier, sides[0].Queue.Len()+sides[1].Queue.Len())
+		side, other := &sides[current], &sides[1-current]
+		item := heap.Pop(&side.Queue).(*Item)
+		node := item.node
+		if seen := side.Seen[node.world]; seen.depth < node.depth {
+			continue
+		}
+		result.Tries++
+		if result.Tries%1024 == 0 && ctx.Err() != nil {
+			logger.Println("Search interrupted :", ctx.Err())
+			return Result{ClosedSetComplexity: len(sides[0].Seen) + len(sides[1].Seen), Tries: result.Tries, Algo: "MM", Interrupted: ctx.Err(), MaxFrontier: result.MaxFrontier}
+		}
+		if result.Tries%1024 == 0 {
+			param.Progress.addNodes(1024)
+			param.Progress.setBound(int(node.score))
+			param.Progress.setSizes(sides[0].Queue.Len()+sides[1].Queue.Len(), len(sides[0].Seen)+len(sides[1].Seen))
+		}
+		if result.Tries%100000 == 0 {
+			logger.Printf("%d * 100k tries. Priority : %d. Best solution : %d\n", result.Tries/100000, node.score, best)
+			availableRAM, err := GetAvailableRAM()
+			if err != nil || availableRAM>>20 < MinRAMAvailableMB || availableRAM < ramMin {
+				logger.Printf("Not enough RAM[%v MB] to continue or Fatal (error reading RAM status)\n", availableRAM>>20)
+				return Result{ClosedSetComplexity: len(sides[0].Seen) + len(sides[1].Seen), Tries: result.Tries, RamFailure: true, Algo: "MM", MaxFrontier: result.MaxFrontier}
+			}
+		}
+		for _, dir := range Directions {
+			if isReverseMove(node.path.Last(), dir.name) {
+				continue
+			}
+			copy(buffer, node.world)
+			empty := int(node.empty)
+			next, ok := moveTiles(buffer, empty, dir.name, size)
+			if !ok {
+				continue
+			}
+			depth := int(node.depth) + 1
+			if seen, ok := side.Seen[State(buffer)]; ok && int(seen.depth) <= depth {
+				continue
+			}
+			h := tiles.Update(int(node.h), buffer, side.Target, buffer[empty], next, empty)
+			child := Node{world: State(buffer), path: &pathNode{parent: node.path, dir: dir.name}, depth: uint16(depth), score: uint16(mmPriority(tiles, depth, h)), h: uint16(h), empty: uint8(next)}
+			side.Seen[child.world] = child
+			heap.Push(&side.Queue, &Item{node: child})
+			if match, ok := other.Seen[child.world]; ok && depth+int(match.depth) < best {
+				best, meeting = depth+int(match.depth), child.world
+			}
+		}
+	}
+	result.ClosedSetComplexity = len(sides[0].Seen) + len(sides[1].Seen)
+	result.Algo = "MM"
+	if tiles.Bound() == 1 {
+		result.Bound = 1
+	}
+	if meeting == "" {
+		return
+	}
+	forward, backward := sides[0].Seen[meeting], sides[1].Seen[meeting]
+	result.Path = joinPaths(forward.path.Moves(int(forward.depth)), backward.path.Moves(int(backward.depth)))
+	logger.Printf("Frontiers met after %d forward and %d backward moves\n", forward.depth, backward.depth)
+	return
+}
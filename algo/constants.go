@@ -1,15 +1,18 @@
 package algo
 
 var Evals = []Eval{
-	{"dijkstra", dijkstra},
-	{"greedy_hamming", greedy_hamming},
-	{"greedy_manhattan", greedy_manhattan},
-	{"astar_hamming", astar_hamming},
-	{"astar_manhattan", astar_manhattan_generator(1)},
-	{"astar_manhattan2", astar_manhattan_generator(2)},
-	{"astar_manhattan1.3", astar_manhattan_generator(1.3)},
-	{"astar_manhattan_conflict", astar_manhattan_generator_conflict(1)},
-	{"astar_manhattan_conflict1.3", astar_manhattan_generator_conflict(1.3)},
+	{Name: "dijkstra", Fx: dijkstra, Tiles: tileEvalGenerator(1, false)},
+	{Name: "greedy_hamming", Fx: greedy_hamming, Tiles: tileEvalGenerator(1, true, hammingHeuristic)},
+	{Name: "greedy_manhattan", Fx: greedy_manhattan, Tiles: tileEvalGenerator(1, true, manhattanHeuristic)},
+	{Name: "greedy_walking_distance", Prepare: walkingDistanceGenerator(true)},
+	{Name: "astar_hamming", Fx: astar_hamming, Tiles: tileEvalGenerator(1, false, hammingHeuristic)},
+	{Name: "astar_manhattan", Fx: astar_manhattan_generator(1), Tiles: tileEvalGenerator(1, false, manhattanHeuristic)},
+	{Name: "astar_manhattan2", Fx: astar_manhattan_generator(2), Tiles: tileEvalGenerator(2, false, manhattanHeuristic)},
+	{Name: "astar_manhattan1.3", Fx: astar_manhattan_generator(1.3), Tiles: tileEvalGenerator(1.3, false, manhattanHeuristic)},
+	{Name: "astar_manhattan_conflict", Fx: astar_manhattan_generator_conflict(1), Tiles: tileEvalGenerator(1, false, manhattanHeuristic, conflictHeuristic)},
+	{Name: "astar_manhattan_conflict1.3", Fx: astar_manhattan_generator_conflict(1.3), Tiles: tileEvalGenerator(1.3, false, manhattanHeuristic, conflictHeuristic)},
+	{Name: "astar_walking_distance", Prepare: walkingDistanceGenerator(false)},
+	{Name: "astar_pdb", Prepare: preparePatternDatabase},
 }
 
 var Directions = []struct {
@@ -23,3 +26,16 @@ var Directions = []struct {
 }
 
 var MinRAMAvailableMB uint64 = 256
+
+// A State stores each tile on one byte, so the biggest board holds 256 tiles
+const (
+	MinMapSize = 3
+	MaxMapSize = 16
+)
+
+// Starting epsilon of ARA* when none is given
+const DefaultARAEpsilon = 3.0
+
+// Version of the solvers, stored with the solutions they find. To be
+// changed with the searches or the heuristics
+const SolverVersion = "1.0.0"
@@ -3,6 +3,7 @@ package algo
 import (
 	//"fmt"
 	"math"
+	"math/bits"
 )
 
 func dijkstra(pos, startPos, goalPos [][]int, path []byte) int {
@@ -93,3 +94,180 @@ func astar_manhattan_generator_conflict(weight float64) EvalFx {
 		return initDist + int(weight*(float64(greedy_manhattan(pos, startPos, goalPos, path))+float64(greedy_conflict(pos, startPos, goalPos, path))))
 	}
 }
+
+func (eval *TileEval) Heuristic(tiles []byte, goal *GoalTable) (h int) {
+	for _, part := range eval.Parts {
+		h += part.Full(tiles, goal)
+	}
+	return h
+}
+
+// Updates the parent's heuristic value after tile moved from cell `from` to
+// cell `to`, tiles being the board after the move. Heuristics are computed
+// again from scratch as soon as one part has no Delta
+func (eval *TileEval) Update(h int, tiles []byte, goal *GoalTable, tile byte, from, to int) int {
+	for _, part := range eval.Parts {
+		if part.Delta == nil {
+			return eval.Heuristic(tiles, goal)
+		}
+	}
+	for _, part := range eval.Parts {
+		h += part.Delta(tiles, goal, tile, from, to)
+	}
+	return h
+}
+
+// Same scoring as the EvalFx, pathLen being the length of the path given to it
+func (eval *TileEval) Score(pathLen int, h int) int {
+	if eval.Greedy {
+		return int(eval.Weight * float64(h))
+	}
+	return pathLen + 1 + int(eval.Weight*float64(h))
+}
+
+// Factor by which a solution found with this scoring may exceed the optimal
+// one, its parts being admissible. 0 when there is no such bound
+func (eval *TileEval) Bound() float64 {
+	if eval == nil || eval.Greedy {
+		return 0
+	}
+	if eval.Weight < 1 {
+		return 1
+	}
+	return eval.Weight
+}
+
+// Same parts with their weight multiplied by epsilon
+func (eval *TileEval) Inflate(epsilon float64) *TileEval {
+	inflated := *eval
+	inflated.Weight *= epsilon
+	return &inflated
+}
+
+func tileEvalGenerator(weight float64, greedy bool, parts ...Heuristic) *TileEval {
+	return &TileEval{Parts: parts, Weight: weight, Greedy: greedy}
+}
+
+var manhattanHeuristic = Heuristic{Full: manhattanFull, Delta: manhattanDelta}
+var hammingHeuristic = Heuristic{Full: hammingFull, Delta: hammingDelta}
+var conflictHeuristic = Heuristic{Full: conflictFull, Delta: conflictDelta}
+
+func tileDistance(goal *GoalTable, tile byte, cell int) int {
+	return Abs(cell/goal.Size-goal.Row[tile]) + Abs(cell%goal.Size-goal.Col[tile])
+}
+
+func manhattanFull(tiles []byte, goal *GoalTable) (score int) {
+	for cell, tile := range tiles {
+		if tile != 0 {
+			score += tileDistance(goal, tile, cell)
+		}
+	}
+	return score
+}
+
+func manhattanDelta(tiles []byte, goal *GoalTable, tile byte, from, to int) int {
+	return tileDistance(goal, tile, to) - tileDistance(goal, tile, from)
+}
+
+func hammingFull(tiles []byte, goal *GoalTable) (score int) {
+	for cell, tile := range tiles {
+		if tile != 0 && tileDistance(goal, tile, cell) != 0 {
+			score++
+		}
+	}
+	return score
+}
+
+func hammingDelta(tiles []byte, goal *GoalTable, tile byte, from, to int) (delta int) {
+	if tileDistance(goal, tile, to) != 0 {
+		delta++
+	}
+	if tileDistance(goal, tile, from) != 0 {
+		delta--
+	}
+	return delta
+}
+
+// Same count as a ConflictGraph on one line, without allocation : tiles in
+// their goal line but not in their goal cell conflict when they are in
+// reverse order, and the most conflicting tile is removed until none is left.
+// Ties go to the first tile of the line
+func lineConflicts(tiles []byte, goal *GoalTable, line int, isRow bool) (count int) {
+	size := goal.Size
+	var adjacency [MaxMapSize]uint32
+	var target [MaxMapSize]int
+	for k := 0; k < size; k++ {
+		cell := line*size + k
+		if !isRow {
+			cell = k*size + line
+		}
+		tile := tiles[cell]
+		target[k] = -1
+		if tile == 0 || tileDistance(goal, tile, cell) == 0 {
+			continue
+		}
+		if isRow && goal.Row[tile] == line {
+			target[k] = goal.Col[tile]
+		} else if !isRow && goal.Col[tile] == line {
+			target[k] = goal.Row[tile]
+		}
+		if target[k] == -1 {
+			continue
+		}
+		for l := 0; l < k; l++ {
+			if target[l] > target[k] {
+				adjacency[l] |= 1 << k
+				adjacency[k] |= 1 << l
+			}
+		}
+	}
+	for {
+		highest, max := -1, 0
+		for k := 0; k < size; k++ {
+			if degree := bits.OnesCount32(adjacency[k]); degree > max {
+				highest, max = k, degree
+			}
+		}
+		if highest == -1 {
+			return count
+		}
+		for k := 0; k < size; k++ {
+			adjacency[k] &^= 1 << highest
+		}
+		adjacency[highest] = 0
+		count++
+	}
+}
+
+func conflictFull(tiles []byte, goal *GoalTable) (conflict int) {
+	for line := 0; line < goal.Size; line++ {
+		conflict += lineConflicts(tiles, goal, line, true)
+		conflict += lineConflicts(tiles, goal, line, false)
+	}
+	return 2 * conflict
+}
+
+// A vertical move changes the rows it leaves and enters and, as the tile may
+// leave or reach its goal cell, its column. Horizontal moves are symmetric.
+// The parent board is restored in place to count conflicts before the move
+func conflictDelta(tiles []byte, goal *GoalTable, tile byte, from, to int) int {
+	size := goal.Size
+	vertical := from%size == to%size
+	lines := func() (conflict int) {
+		if vertical {
+			conflict += lineConflicts(tiles, goal, from/size, true)
+			conflict += lineConflicts(tiles, goal, to/size, true)
+			conflict += lineConflicts(tiles, goal, from%size, false)
+		} else {
+			conflict += lineConflicts(tiles, goal, from%size, false)
+			conflict += lineConflicts(tiles, goal, to%size, false)
+			conflict += lineConflicts(tiles, goal, from/size, true)
+		}
+		return conflict
+	}
+	after := lines()
+	tiles[from], tiles[to] = tiles[to], tiles[from]
+	before := lines()
+	tiles[from], tiles[to] = tiles[to], tiles[from]
+	return 2 * (after - before)
+}
@@ -0,0 +1,67 @@
+package algo
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func TestWalkingDistance(t *testing.T) {
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for size := 3; size <= 4; size++ {
+			wd := getWalkingDistance(size, disposition, nil)
+			goal := Goal(size, disposition)
+			if got := wd.Heuristic([]byte(BoardToState(goal))); got != 0 {
+				t.Errorf("[%s] Heuristic([]byte(BoardToState(goal))) = %d", disposition, got)
+			}
+			for i := 0; i < 50; i++ {
+				board := shuffledGrid(size, disposition)
+				if got, manhattan := wd.Heuristic([]byte(BoardToState(board))), greedy_manhattan(board, board, goal, nil); got < manhattan {
+					t.Errorf("[%s] Heuristic(%v) = %d below manhattan distance %d", disposition, board, got, manhattan)
+				}
+			}
+		}
+		for i := 0; i < 20; i++ {
+			board := GridGenerator(3, disposition)
+			param := AlgoParameters{Board: board, Disposition: disposition, Eval: evalByName(t, "astar_manhattan_conflict")}
+			data := initDataIDA(param)
+			result := iterateIDA(context.Background(), &data)
+			if got := getWalkingDistance(3, disposition, nil).Heuristic([]byte(BoardToState(board))); got > len(result.Path) {
+				t.Errorf("[%s] Heuristic(%v) = %d with an optimal solution of %d moves", disposition, board, got, len(result.Path))
+			}
+		}
+	}
+}
+
+func TestIncrementalHeuristics(t *testing.T) {
+	parts := map[string]Heuristic{"manhattan": manhattanHeuristic, "hamming": hammingHeuristic, "conflict": conflictHeuristic}
+	legacy := map[string]EvalFx{"manhattan": greedy_manhattan, "hamming": greedy_hamming}
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for size := 3; size <= 5; size++ {
+			goal := Goal(size, disposition)
+			goalTable := NewGoalTable(goal)
+			for name, part := range parts {
+				board := shuffledGrid(size, disposition)
+				h := part.Full([]byte(BoardToState(board)), goalTable)
+				for step := 0; step < 200; step++ {
+					empty := getValuePostion(board, 0)
+					dir := Directions[rand.Intn(len(Directions))]
+					ok, nextBoard := dir.fx(board)
+					if !ok {
+						continue
+					}
+					tiles := []byte(BoardToState(nextBoard))
+					from, to := nextEmptyCell(empty, dir.name, size), empty.Y*size+empty.X
+					h += part.Delta(tiles, goalTable, tiles[to], from, to)
+					if full := part.Full(tiles, goalTable); h != full {
+						t.Fatalf("[%s %s] incremental value %d, full value %d for %v", disposition, name, h, full, nextBoard)
+					}
+					if fx, ok := legacy[name]; ok && fx(nextBoard, nil, goal, nil) != h {
+						t.Fatalf("[%s %s] incremental value %d, EvalFx value %d for %v", disposition, name, h, fx(nextBoard, nil, goal, nil), nextBoard)
+					}
+					board = nextBoard
+				}
+			}
+		}
+	}
+}
@@ -1,7 +1,15 @@
 package algo
 
+import (
+	"math/rand"
+	"time"
+)
+
 func GridGenerator(mapSize int, disposition string) (board [][]int) {
 
+	if mapSize > 4 {
+		return shuffledGrid(mapSize, disposition)
+	}
 	for {
 		randomNumber := make(map[int]int)
 		for i := 0; i < mapSize*mapSize; i++ {
@@ -26,6 +34,23 @@ func GridGenerator(mapSize int, disposition string) (board [][]int) {
 	return board
 }
 
+// Shuffled boards past 4x4 almost never meet the inversion limit, so bigger
+// boards are a uniform shuffle of the tiles, kept when its parity makes it
+// solvable
+func shuffledGrid(mapSize int, disposition string) (board [][]int) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		tiles := random.Perm(mapSize * mapSize)
+		board = make([][]int, mapSize)
+		for i := range board {
+			board[i] = tiles[i*mapSize : (i+1)*mapSize]
+		}
+		if ok, _ := IsSolvable(board, disposition); ok {
+			return board
+		}
+	}
+}
+
 func Goal(mapSize int, disposition string) (goal [][]int) {
 	switch disposition {
 	case "snail":
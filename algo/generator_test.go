@@ -1,6 +1,7 @@
 package algo
 
 import (
+	"bufio"
 	"testing"
 )
 
@@ -8,7 +9,7 @@ func TestGridGenerator(t *testing.T) {
 	test := []int{3, 4, 5, 6, 7, 8}
 	for _, test := range test {
 		values := map[int]int{}
-		grid := GridGenerator(test)
+		grid := GridGenerator(test, "snail")
 		for _, row := range grid {
 			for _, item := range row {
 				if _, ok := values[item]; ok {
@@ -32,7 +33,7 @@ func TestGoal(t *testing.T) {
 		{5, [][]int{{1, 2, 3, 4, 5}, {16, 17, 18, 19, 6}, {15, 24, 0, 20, 7}, {14, 23, 22, 21, 8}, {13, 12, 11, 10, 9}}},
 	}
 	for _, test := range test {
-		if goal := goal(test.mapSize); isEqual(goal, test.goal) != true {
+		if goal := Goal(test.mapSize, "snail"); isEqual(goal, test.goal) != true {
 			t.Errorf("goal(%v) = %v", test.mapSize, goal)
 		}
 	}
@@ -55,7 +56,7 @@ func TestIsEqual(t *testing.T) {
 
 }
 
-func TestmatrixToTableSnail(t *testing.T) {
+func TestMatrixToTableSnail(t *testing.T) {
 	test := []struct {
 		matrix [][]int
 		want   []int
@@ -73,24 +74,50 @@ func TestmatrixToTableSnail(t *testing.T) {
 }
 
 func TestIsSolvable(t *testing.T) {
-	dir := "maps/solvables/"
+	dir := "../maps/solvables/"
 	files := openDir(dir)
 	for _, file := range files {
 		openFile := dir + file.Name()
-		_, matrix := ParseInput(OpenFile(openFile))
+		fd, err := OpenFile(openFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matrix, err := ParseInput(bufio.NewScanner(fd))
+		fd.Close()
+		if err != nil {
+			t.Errorf("file [%v] ParseInput error : %v", file.Name(), err)
+			continue
+		}
+		ok, _ := IsSolvable(matrix, "snail")
 		if file.Name()[0:1] == "u" {
-			if isSolvable(matrix) != false {
-				t.Errorf("file [%v] isSolvable(%v) = %v", file.Name(), matrix, isSolvable(matrix))
+			if ok != false {
+				t.Errorf("file [%v] IsSolvable(%v) = %v", file.Name(), matrix, ok)
 			}
 		} else {
-			if isSolvable(matrix) != true {
-				t.Errorf("file [%v] isSolvable(%v) = %v", file.Name(), matrix, isSolvable(matrix))
+			if ok != true {
+				t.Errorf("file [%v] IsSolvable(%v) = %v", file.Name(), matrix, ok)
 			}
 		}
 	}
 
 }
 
+func TestBoardToState(t *testing.T) {
+	for size := MinMapSize; size <= 8; size++ {
+		board := GridGenerator(size, "snail")
+		state := BoardToState(board)
+		if len(state) != size*size {
+			t.Errorf("BoardToState(%v) has length %d", board, len(state))
+		}
+		if got := StateToBoard(state, size); isEqual(got, board) != true {
+			t.Errorf("StateToBoard(BoardToState(%v)) = %v", board, got)
+		}
+		if ok, _ := IsSolvable(board, "snail"); !ok {
+			t.Errorf("GridGenerator(%d) = %v is not solvable", size, board)
+		}
+	}
+}
+
 func TestMatrixToString(t *testing.T) {
 
 	test := []struct {
@@ -101,7 +128,7 @@ func TestMatrixToString(t *testing.T) {
 		{[][]int{{1, 2, 3, 4}, {12, 13, 14, 5}, {11, 0, 15, 6}, {10, 9, 8, 7}}, "1.2.3.4.12.13.14.5.11.0.15.6.10.9.8.7."},
 	}
 	for _, test := range test {
-		if got, _, _ := matrixToStringNoOpti(test.matrix, 1, 1); got != test.want {
+		if got := MatrixToStringHashOnly(test.matrix, "."); got != test.want {
 			t.Errorf("matrixTo(%v) = %v", test.matrix, got)
 		}
 	}
@@ -0,0 +1,141 @@
+package algo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// The tree is split once there are this many subtrees per worker, so that
+// workers stay busy when some subtrees are pruned early
+const idaSubtreesPerWorker = 16
+
+func (data *idaData) clone() (dup idaData) {
+	dup = *data
+	dup.Board = append([]byte{}, data.Board...)
+	dup.Path = append(make([]byte, 0, 256), data.Path...)
+	dup.Hashes = append(make([]uint64, 0, 256), data.Hashes...)
+	if data.H != nil {
+		dup.H = append(make([]int, 0, 256), data.H...)
+	}
+	dup.Tries, dup.ClosedSetComplexity = 0, 0
+	return
+}
+
+func (data *idaData) child(dir byte) (child idaData, ok bool) {
+	if len(data.Path) > 0 && isReverseMove(data.Path[len(data.Path)-1], dir) {
+		return child, false
+	}
+	child = data.clone()
+	empty := child.Empty
+	next, ok := moveTiles(child.Board, empty, dir, child.Size)
+	if !ok {
+		return child, false
+	}
+	tile := child.Board[empty]
+	hash := zobristUpdate(child.Hashes[len(child.Hashes)-1], tile, next, empty)
+	if Index(child.Hashes, hash) != -1 {
+		return child, false
+	}
+	if child.Tiles != nil {
+		child.H = append(child.H, child.Tiles.Update(child.H[len(child.H)-1], child.Board, child.GoalTable, tile, next, empty))
+	}
+	child.Empty = next
+	child.Path = append(child.Path, dir)
+	child.Hashes = append(child.Hashes, hash)
+	return child, true
+}
+
+// Breadth first expansion from the root : every layer is complete, so a goal
+// met there is an optimal solution
+func idaFrontier(root *idaData, subtrees int) (frontier []idaData, goal *idaData) {
+	frontier = []idaData{root.clone()}
+	for len(frontier) < subtrees {
+		next := []idaData{}
+		seen := map[uint64]bool{}
+		for i := range frontier {
+			for _, dir := range Directions {
+				child, ok := frontier[i].child(dir.name)
+				if !ok || seen[child.Hashes[len(child.Hashes)-1]] {
+					continue
+				}
+				root.Tries++
+				if string(child.Board) == string(child.GoalState) {
+					return nil, &child
+				}
+				seen[child.Hashes[len(child.Hashes)-1]] = true
+				next = append(next, child)
+			}
+		}
+		frontier = next
+	}
+	return frontier, nil
+}
+
+// Every cut off is searched by all workers, each taking the next subtree of
+// the frontier until none is left. The first worker reaching the goal stops
+// the others, otherwise the next cut off is the lowest score they met above
+// the current one
+func launchIDAWorkers(ctx context.Context, param AlgoParameters) (result Result) {
+	root := initDataIDA(param)
+	if string(root.Board) == string(root.GoalState) {
+		return Result{Path: []byte{}, ClosedSetComplexity: 1, Tries: 1, Algo: "IDA", Bound: root.Tiles.Bound(), MaxFrontier: 1}
+	}
+	frontier, goal := idaFrontier(&root, param.Workers*idaSubtreesPerWorker)
+	if goal != nil {
+		return Result{Path: goal.Path, ClosedSetComplexity: len(goal.Hashes), Tries: root.Tries, Algo: "IDA", Bound: root.Tiles.Bound(), MaxFrontier: len(goal.Hashes)}
+	}
+	root.Logger.Printf("Selected ALGO : IDA* (%d workers, %d subtrees at depth %d)\n", param.Workers, len(frontier), len(frontier[0].Path))
+	var stop int32
+	for i := range frontier {
+		frontier[i].Stop = &stop
+	}
+	for maxScore := root.MaxScore; maxScore < 1<<30; {
+		root.Logger.Println("Cut off is now :", maxScore)
+		root.Progress.setBound(maxScore)
+		var wg sync.WaitGroup
+		var nextSubtree int64
+		winner := int64(-1)
+		minScores := make([]int, param.Workers)
+		for worker := 0; worker < param.Workers; worker++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				minScores[worker] = 1 << 30
+				for atomic.LoadInt32(&stop) == 0 && ctx.Err() == nil {
+					index := atomic.AddInt64(&nextSubtree, 1) - 1
+					if index >= int64(len(frontier)) {
+						return
+					}
+					frontier[index].MaxScore = maxScore
+					newMaxScore, found := ida(ctx, &frontier[index])
+					if found {
+						if atomic.CompareAndSwapInt32(&stop, 0, 1) {
+							atomic.StoreInt64(&winner, index)
+						}
+						return
+					}
+					minScores[worker] = Min(minScores[worker], newMaxScore)
+				}
+			}(worker)
+		}
+		wg.Wait()
+		for i := range frontier {
+			root.Tries += frontier[i].Tries
+			frontier[i].Tries = 0
+			root.ClosedSetComplexity = Max(root.ClosedSetComplexity, frontier[i].ClosedSetComplexity)
+		}
+		if winner != -1 {
+			return Result{Path: frontier[winner].Path, ClosedSetComplexity: root.ClosedSetComplexity, Tries: root.Tries, Algo: "IDA", Bound: root.Tiles.Bound(), MaxFrontier: root.ClosedSetComplexity}
+		}
+		if err := ctx.Err(); err != nil {
+			root.Logger.Println("Search interrupted :", err)
+			return Result{ClosedSetComplexity: root.ClosedSetComplexity, Tries: root.Tries, Algo: "IDA", Interrupted: err, MaxFrontier: root.ClosedSetComplexity}
+		}
+		maxScore = 1 << 30
+		for _, score := range minScores {
+			maxScore = Min(maxScore, score)
+		}
+	}
+	return
+}
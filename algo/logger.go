@@ -0,0 +1,20 @@
+package algo
+
+// Receives the messages of a solve. *log.Logger satisfies it
+type Logger interface {
+	Printf(format string, v ...any)
+	Println(v ...any)
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...any) {}
+
+func (discardLogger) Println(v ...any) {}
+
+func (param *AlgoParameters) logger() Logger {
+	if param.Logger == nil {
+		return discardLogger{}
+	}
+	return param.Logger
+}
@@ -15,42 +15,99 @@ func swap[T any](a, b *T) {
 	*a, *b = *b, *a
 }
 
-func moveUp(board [][] int) (ok bool, updatedBoard [][]int) {
-	empty := getValuePostion(board, 0)
-	updatedBoard = Deep2DSliceCopy(board)
-	if empty.Y != 0 {
-		swap(&updatedBoard[empty.Y][empty.X], &updatedBoard[empty.Y-1][empty.X])
-		return true, updatedBoard
+// Cell reached by the empty tile when moving in direction dir, or false when
+// dir is not a move or leaves the board. Every move of the empty tile, on
+// boards or on flat tiles, goes through it
+func stepEmpty(empty Pos2D, dir byte, size int) (next Pos2D, ok bool) {
+	next = empty
+	switch dir {
+	case 'U':
+		next.Y--
+	case 'D':
+		next.Y++
+	case 'L':
+		next.X--
+	case 'R':
+		next.X++
+	default:
+		return empty, false
 	}
-	return false, nil
+	if next.X < 0 || next.X >= size || next.Y < 0 || next.Y >= size {
+		return empty, false
+	}
+	return next, true
 }
 
-func moveDown(board [][]int) (ok bool, updatedBoard [][]int) {
+// Copy of the board with its empty tile moved in direction dir
+func moveBoard(board [][]int, dir byte) (ok bool, updatedBoard [][]int) {
 	empty := getValuePostion(board, 0)
-	updatedBoard = Deep2DSliceCopy(board)
-	if empty.Y != len(board)-1 {
-		swap(&updatedBoard[empty.Y][empty.X], &updatedBoard[empty.Y+1][empty.X])
-		return true, updatedBoard
+	next, ok := stepEmpty(empty, dir, len(board))
+	if !ok {
+		return false, nil
 	}
-	return false, nil
+	updatedBoard = Deep2DSliceCopy(board)
+	swap(&updatedBoard[empty.Y][empty.X], &updatedBoard[next.Y][next.X])
+	return true, updatedBoard
+}
+
+func moveUp(board [][]int) (ok bool, updatedBoard [][]int) {
+	return moveBoard(board, 'U')
+}
+
+func moveDown(board [][]int) (ok bool, updatedBoard [][]int) {
+	return moveBoard(board, 'D')
 }
 
 func moveLeft(board [][]int) (ok bool, updatedBoard [][]int) {
-	empty := getValuePostion(board, 0)
-	updatedBoard = Deep2DSliceCopy(board)
-	if empty.X != 0 {
-		swap(&updatedBoard[empty.Y][empty.X], &updatedBoard[empty.Y][empty.X-1])
-		return true, updatedBoard
-	}
-	return false, nil
+	return moveBoard(board, 'L')
 }
 
 func moveRight(board [][]int) (ok bool, updatedBoard [][]int) {
-	empty := getValuePostion(board, 0)
-	updatedBoard = Deep2DSliceCopy(board)
-	if empty.X != len(board)-1 {
-		swap(&updatedBoard[empty.Y][empty.X], &updatedBoard[empty.Y][empty.X+1])
-		return true, updatedBoard
+	return moveBoard(board, 'R')
+}
+
+// Cell reached by the empty tile when moving in direction dir. The moved
+// tile goes the other way, to the previous cell of the empty tile
+func nextEmptyCell(empty Pos2D, dir byte, size int) int {
+	next, _ := stepEmpty(empty, dir, size)
+	return next.Y*size + next.X
+}
+
+// Moves the empty tile of a flat board in place, without allocation. Returns
+// the new cell of the empty tile, the moved tile now being in cell `empty`
+func moveTiles(tiles []byte, empty int, dir byte, size int) (next int, ok bool) {
+	cell, ok := stepEmpty(Pos2D{X: empty % size, Y: empty / size}, dir, size)
+	if !ok {
+		return empty, false
+	}
+	next = cell.Y*size + cell.X
+	tiles[empty], tiles[next] = tiles[next], tiles[empty]
+	return next, true
+}
+
+func emptyCell(tiles []byte) int {
+	for cell, tile := range tiles {
+		if tile == 0 {
+			return cell
+		}
 	}
-	return false, nil
+	return -1
+}
+
+func reverseMove(dir byte) byte {
+	switch dir {
+	case 'U':
+		return 'D'
+	case 'D':
+		return 'U'
+	case 'L':
+		return 'R'
+	case 'R':
+		return 'L'
+	}
+	return 0
+}
+
+func isReverseMove(last, dir byte) bool {
+	return last != 0 && reverseMove(last) == dir
 }
@@ -0,0 +1,110 @@
+package algo
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type SolveStatus int
+
+const (
+	StatusOK SolveStatus = iota
+	StatusInvalidFlags
+	StatusInvalidParam
+	StatusRAMFailure
+	StatusTimeout
+	StatusCancelled
+	StatusNoSolution
+)
+
+// JSON names of the statuses, kept identical to the strings Solve used to
+// return
+var statusNames = map[SolveStatus]string{
+	StatusOK:           "OK",
+	StatusInvalidFlags: "FLAGS",
+	StatusInvalidParam: "PARAM",
+	StatusRAMFailure:   "RAM",
+	StatusTimeout:      "TIMEOUT",
+	StatusCancelled:    "CANCELLED",
+	StatusNoSolution:   "END",
+}
+
+func (status SolveStatus) String() string {
+	if name, ok := statusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("SolveStatus(%d)", int(status))
+}
+
+func (status SolveStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(status.String())
+}
+
+func (status *SolveStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for current, currentName := range statusNames {
+		if currentName == name {
+			*status = current
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown solve status %q", name)
+}
+
+// Moves of the empty tile, encoded in JSON as a string such as "ULDR"
+type Moves []byte
+
+func (moves Moves) String() string {
+	return string(moves)
+}
+
+func (moves Moves) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(moves))
+}
+
+func (moves *Moves) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err != nil {
+		return err
+	}
+	for i := range path {
+		if Index([]byte("UDLR"), path[i]) == -1 {
+			return fmt.Errorf("Invalid move %q", path[i])
+		}
+	}
+	*moves = Moves(path)
+	return nil
+}
+
+// Nodes counts the expanded nodes. MaxFrontier is the largest open list,
+// summed over the workers of a parallel search, or the depth of the search
+// stack for IDA*. ClosedSet counts the stored states. Bound is how many times
+// longer than optimal Moves may be, 0 when unknown. Error explains a status
+// other than OK
+type SolveOutcome struct {
+	Status      SolveStatus   `json:"status"`
+	Moves       Moves         `json:"moves"`
+	Duration    time.Duration `json:"durationNs"`
+	Nodes       int           `json:"nodes"`
+	MaxFrontier int           `json:"maxFrontier"`
+	Heuristic   string        `json:"heuristic"`
+	Algorithm   string        `json:"algorithm"`
+	Bound       float64       `json:"bound"`
+	ClosedSet   int           `json:"closedSet"`
+	Error       string        `json:"error,omitempty"`
+	Board       [][]int       `json:"-"`
+}
+
+func (outcome SolveOutcome) String() string {
+	switch outcome.Status {
+	case StatusOK:
+		return fmt.Sprintf("[%s %s %s]", outcome.Status, outcome.Moves, outcome.Duration)
+	case StatusInvalidFlags, StatusInvalidParam:
+		return fmt.Sprintf("[%s %s]", outcome.Status, outcome.Error)
+	}
+	return fmt.Sprintf("[%s %d nodes %s]", outcome.Status, outcome.Nodes, outcome.Duration)
+}
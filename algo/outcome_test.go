@@ -0,0 +1,28 @@
+package algo
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSolveOutcomeJSON(t *testing.T) {
+	outcome := SolveOutcome{Status: StatusTimeout, Moves: Moves("ULDR"), Duration: time.Second, Nodes: 12, MaxFrontier: 3, Heuristic: "astar_manhattan", Algorithm: "IDA", Bound: 1, ClosedSet: 40, Error: "context deadline exceeded"}
+	content, err := json.Marshal(outcome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"status":"TIMEOUT","moves":"ULDR","durationNs":1000000000,"nodes":12,"maxFrontier":3,"heuristic":"astar_manhattan","algorithm":"IDA","bound":1,"closedSet":40,"error":"context deadline exceeded"}`
+	if string(content) != expected {
+		t.Errorf("json.Marshal(%v) = %s", outcome, content)
+	}
+	var decoded SolveOutcome
+	if err := json.Unmarshal(content, &decoded); err != nil || decoded.Status != outcome.Status || decoded.Moves.String() != "ULDR" {
+		t.Errorf("json.Unmarshal(%s) = %v, %v", content, decoded, err)
+	}
+	for _, invalid := range []string{`{"status":"DONE"}`, `{"moves":"UXD"}`} {
+		if err := json.Unmarshal([]byte(invalid), &decoded); err == nil {
+			t.Errorf("json.Unmarshal(%s) accepted an invalid outcome", invalid)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package algo
+
+import "fmt"
+
+// Boards met along the moves of the empty tile, from board itself to the
+// board reached by the last move. Fails on a move leaving the board
+func PlayMoves(board [][]int, moves Moves) (boards [][][]int, err error) {
+	if getValuePostion(board, 0).X == -1 {
+		return nil, fmt.Errorf("Board has no empty tile")
+	}
+	boards = append(make([][][]int, 0, len(moves)+1), board)
+	for i, dir := range moves {
+		if reverseMove(dir) == 0 {
+			return nil, fmt.Errorf("Invalid move %q at %d", dir, i)
+		}
+		ok, next := moveBoard(boards[i], dir)
+		if !ok {
+			return nil, fmt.Errorf("Move %d (%c) leaves the board", i, dir)
+		}
+		boards = append(boards, next)
+	}
+	return boards, nil
+}
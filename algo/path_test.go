@@ -0,0 +1,44 @@
+package algo
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPlayMoves(t *testing.T) {
+	board := [][]int{{1, 2, 3}, {0, 4, 5}, {7, 8, 6}}
+	boards, err := PlayMoves(board, Moves("RRD"))
+	if err != nil || len(boards) != 4 || !isEqual(boards[3], Goal(3, "zerolast")) || !isEqual(boards[0], board) {
+		t.Errorf("PlayMoves(%v, RRD) = %v, %v", board, boards, err)
+	}
+	for _, moves := range []string{"L", "RRR", "RX"} {
+		if _, err := PlayMoves(board, Moves(moves)); err == nil {
+			t.Errorf("PlayMoves(%v, %s) played an invalid move", board, moves)
+		}
+	}
+}
+
+// PlayMoves, Verify and the in-place moves of the solvers agree on every move
+func TestMovesAgree(t *testing.T) {
+	for size := 3; size <= 5; size++ {
+		board := shuffledGrid(size, "snail")
+		tiles := []byte(BoardToState(board))
+		empty := emptyCell(tiles)
+		var moves Moves
+		for i := 0; i < 100; i++ {
+			dir := Directions[rand.Intn(len(Directions))].name
+			next, ok := moveTiles(tiles, empty, dir, size)
+			if _, err := PlayMoves(board, append(moves, dir)); (err == nil) != ok {
+				t.Fatalf("PlayMoves(%v, %s) = %v, moveTiles() = %v", board, append(moves, dir), err, ok)
+			}
+			if ok {
+				moves, empty = append(moves, dir), next
+			}
+		}
+		boards, _ := PlayMoves(board, moves)
+		verification := Verify(board, "snail", moves)
+		if last := boards[len(boards)-1]; !isEqual(last, StateToBoard(State(tiles), size)) || !isEqual(last, verification.Final) || verification.Played != len(moves) {
+			t.Errorf("Moves %s of %v reach %v with PlayMoves, %v with moveTiles, %v with Verify", moves, board, last, StateToBoard(State(tiles), size), verification.Final)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package algo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default tile partitions for the additive pattern database heuristic. Tiles
+// are grouped following their order in the goal, so each group is a
+// contiguous part of the goal for both snail and zerolast dispositions
+var DefaultPartitions = map[int]string{
+	3: "4-4",
+	4: "6-6-3",
+	5: "5-5-5-5-4",
+}
+
+const (
+	unreachedCost    = 255
+	pdbMagic         = "NPDB"
+	pdbFormatVersion = 1
+)
+
+// Most tiles in a group : the build packs the cells of the group tiles and of
+// the empty cell in a uint64, a byte each
+const maxGroupTiles = 7
+
+// Most memory the build of a group table may take. It keeps a byte per
+// placement of the group tiles and of the empty cell : 7 tiles of a 4x4 board
+// take 980 MB, 8 tiles 8.3 GB
+const maxGroupBuildBytes = 1 << 30
+
+// Tables are indexed by the rank of the positions of the group tiles, seen as
+// a partial permutation of the board cells
+type PatternDatabase struct {
+	Size        int
+	Disposition string
+	Groups      [][]int
+	Tables      [][]byte
+}
+
+var pdbCache = struct {
+	sync.Mutex
+	dbs map[string]*PatternDatabase
+}{dbs: map[string]*PatternDatabase{}}
+
+func PatternDatabaseDir() string {
+	if dir := os.Getenv("NPUZZLE_PDB_DIR"); dir != "" {
+		return dir
+	}
+	return "pdb"
+}
+
+func PatternDatabaseFile(size int, disposition string, partition string) string {
+	return filepath.Join(PatternDatabaseDir(), fmt.Sprintf("pdb_%d_%s_%s.bin", size, disposition, partition))
+}
+
+func parsePartition(size int, partition string) (groups [][]int, err error) {
+	cells := size * size
+	tile := 1
+	for _, word := range strings.Split(partition, "-") {
+		count, err := strconv.Atoi(word)
+		if err == nil && count <= cells && groupBuildBytes(cells, count) > maxGroupBuildBytes {
+			return nil, fmt.Errorf("Invalid partition [%s] : the build of a group of %d tiles on a %dx%d board needs more than the %d MB of memory it may use", partition, count, size, size, maxGroupBuildBytes>>20)
+		}
+		if err != nil || count < 1 || count > maxGroupTiles {
+			return nil, fmt.Errorf("Invalid partition [%s] : group sizes must be between 1 and %d", partition, maxGroupTiles)
+		}
+		group := []int{}
+		for i := 0; i < count; i++ {
+			group = append(group, tile)
+			tile++
+		}
+		groups = append(groups, group)
+	}
+	if tile != size*size {
+		return nil, fmt.Errorf("Invalid partition [%s] : groups must cover the %d tiles of the board", partition, size*size-1)
+	}
+	return groups, nil
+}
+
+func partialPermutationCount(cells, picked int) (count int) {
+	count = 1
+	for i := 0; i < picked; i++ {
+		count *= cells - i
+	}
+	return
+}
+
+// Memory taken by the build of the table of a group of tiles, or a value above
+// maxGroupBuildBytes once it passes it
+func groupBuildBytes(cells, tiles int) (bytes int) {
+	bytes = cells + 1
+	for i := 0; i < tiles && bytes <= maxGroupBuildBytes; i++ {
+		bytes *= cells - i
+	}
+	return
+}
+
+// Ranks distinct cells as a partial permutation : the first cell has `cells`
+// choices, the next one `cells - 1` and so on
+func rankPositions(positions []int, cells int) (rank int) {
+	for i, pos := range positions {
+		smaller := 0
+		for _, prev := range positions[:i] {
+			if prev < pos {
+				smaller++
+			}
+		}
+		rank = rank*(cells-i) + pos - smaller
+	}
+	return
+}
+
+// Builds the table of one group with a 0-1 breadth first search from the goal :
+// moving a tile of the group costs 1, moving any other tile is free. Summing
+// groups stays admissible as every real move is counted by one group at most
+func buildGroupTable(goal [][]int, group []int) (table []byte) {
+	size := len(goal)
+	cells := size * size
+	start := make([]int, len(group)+1)
+	for i, tile := range group {
+		goodPosition := getValuePostion(goal, tile)
+		start[i] = goodPosition.Y*size + goodPosition.X
+	}
+	empty := getValuePostion(goal, 0)
+	start[len(group)] = empty.Y*size + empty.X
+
+	ranks := partialPermutationCount(cells, len(group))
+	dist := make([]byte, ranks*cells)
+	for i := range dist {
+		dist[i] = unreachedCost
+	}
+	table = make([]byte, ranks)
+	for i := range table {
+		table[i] = unreachedCost
+	}
+
+	pack := func(positions []int) (packed uint64) {
+		for i := len(positions) - 1; i >= 0; i-- {
+			packed = packed<<8 | uint64(positions[i])
+		}
+		return
+	}
+	unpack := func(packed uint64, positions []int) {
+		for i := range positions {
+			positions[i] = int(packed & 255)
+			packed >>= 8
+		}
+	}
+
+	adjacency := make([][]int, cells)
+	for cell := range adjacency {
+		adjacency[cell] = neighbourCells(cell, size)
+	}
+	positions := make([]int, len(group)+1)
+	current := []uint64{pack(start)}
+	dist[rankPositions(start[:len(group)], cells)*cells+start[len(group)]] = 0
+	for cost := 0; len(current) > 0; cost++ {
+		next := []uint64{}
+		for i := 0; i < len(current); i++ {
+			unpack(current[i], positions)
+			patternRank := rankPositions(positions[:len(group)], cells)
+			blank := positions[len(group)]
+			if int(dist[patternRank*cells+blank]) != cost {
+				continue
+			}
+			if byte(cost) < table[patternRank] {
+				table[patternRank] = byte(cost)
+			}
+			for _, neighbour := range adjacency[blank] {
+				moved := Index(positions[:len(group)], neighbour)
+				positions[len(group)] = neighbour
+				if moved != -1 {
+					positions[moved] = blank
+				}
+				nextRank := patternRank
+				if moved != -1 {
+					nextRank = rankPositions(positions[:len(group)], cells)
+				}
+				key := nextRank*cells + neighbour
+				switch {
+				case moved == -1 && int(dist[key]) > cost:
+					dist[key] = byte(cost)
+					current = append(current, pack(positions))
+				case moved != -1 && int(dist[key]) > cost+1:
+					dist[key] = byte(cost + 1)
+					next = append(next, pack(positions))
+				}
+				if moved != -1 {
+					positions[moved] = neighbour
+				}
+				positions[len(group)] = blank
+			}
+		}
+		current = next
+	}
+	return table
+}
+
+func neighbourCells(cell, size int) (neighbours []int) {
+	neighbours = make([]int, 0, 4)
+	if cell >= size {
+		neighbours = append(neighbours, cell-size)
+	}
+	if cell < size*(size-1) {
+		neighbours = append(neighbours, cell+size)
+	}
+	if cell%size != 0 {
+		neighbours = append(neighbours, cell-1)
+	}
+	if cell%size != size-1 {
+		neighbours = append(neighbours, cell+1)
+	}
+	return
+}
+
+func BuildPatternDatabase(size int, disposition string, partition string, logger Logger) (*PatternDatabase, error) {
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	groups, err := parsePartition(size, partition)
+	if err != nil {
+		return nil, err
+	}
+	goal := Goal(size, disposition)
+	if goal == nil {
+		return nil, errors.New("Invalid disposition")
+	}
+	db := &PatternDatabase{Size: size, Disposition: disposition, Groups: groups}
+	for _, group := range groups {
+		logger.Printf("Building pattern database table for tiles %v\n", group)
+		db.Tables = append(db.Tables, buildGroupTable(goal, group))
+	}
+	return db, nil
+}
+
+func (db *PatternDatabase) Heuristic(tiles []byte) (score int) {
+	cells := db.Size * db.Size
+	var tilePositions [MaxMapSize * MaxMapSize]int
+	for cell, tile := range tiles {
+		tilePositions[tile] = cell
+	}
+	var positions [8]int
+	for index, group := range db.Groups {
+		for i, tile := range group {
+			positions[i] = tilePositions[tile]
+		}
+		score += int(db.Tables[index][rankPositions(positions[:len(group)], cells)])
+	}
+	return score
+}
+
+func (db *PatternDatabase) Partition() string {
+	counts := make([]string, len(db.Groups))
+	for i, group := range db.Groups {
+		counts[i] = strconv.Itoa(len(group))
+	}
+	return strings.Join(counts, "-")
+}
+
+// File layout, little endian : magic, format version, size, disposition,
+// then for each group its tiles and table, and a CRC32 of everything before
+func (db *PatternDatabase) Save(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(pdbMagic)
+	header := []uint32{pdbFormatVersion, uint32(db.Size), uint32(len(db.Disposition))}
+	binary.Write(buffer, binary.LittleEndian, header)
+	buffer.WriteString(db.Disposition)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(db.Groups)))
+	for index, group := range db.Groups {
+		groupHeader := []uint32{uint32(len(group))}
+		for _, tile := range group {
+			groupHeader = append(groupHeader, uint32(tile))
+		}
+		groupHeader = append(groupHeader, uint32(len(db.Tables[index])))
+		binary.Write(buffer, binary.LittleEndian, groupHeader)
+		buffer.Write(db.Tables[index])
+	}
+	binary.Write(buffer, binary.LittleEndian, crc32.ChecksumIEEE(buffer.Bytes()))
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+func LoadPatternDatabase(filename string) (*PatternDatabase, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < len(pdbMagic)+4 || string(content[:len(pdbMagic)]) != pdbMagic {
+		return nil, fmt.Errorf("Not a pattern database [%s]", filename)
+	}
+	body := content[:len(content)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(content[len(body):]) {
+		return nil, fmt.Errorf("Corrupted pattern database [%s] : checksum mismatch", filename)
+	}
+	reader := bytes.NewReader(body[len(pdbMagic):])
+	header := make([]uint32, 3)
+	if err := binary.Read(reader, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if header[0] != pdbFormatVersion {
+		return nil, fmt.Errorf("Unsupported pattern database version %d in [%s] (expected %d)", header[0], filename, pdbFormatVersion)
+	}
+	disposition := make([]byte, header[2])
+	if _, err := io.ReadFull(reader, disposition); err != nil {
+		return nil, err
+	}
+	db := &PatternDatabase{Size: int(header[1]), Disposition: string(disposition)}
+	var groupCount uint32
+	if err := binary.Read(reader, binary.LittleEndian, &groupCount); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(groupCount); i++ {
+		var count uint32
+		if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+			return nil, err
+		}
+		groupHeader := make([]uint32, count+1)
+		if err := binary.Read(reader, binary.LittleEndian, groupHeader); err != nil {
+			return nil, err
+		}
+		group := make([]int, count)
+		for j := range group {
+			group[j] = int(groupHeader[j])
+		}
+		if int(groupHeader[count]) != partialPermutationCount(db.Size*db.Size, len(group)) {
+			return nil, fmt.Errorf("Corrupted pattern database [%s] : wrong table length", filename)
+		}
+		table := make([]byte, groupHeader[count])
+		if _, err := io.ReadFull(reader, table); err != nil {
+			return nil, err
+		}
+		db.Groups = append(db.Groups, group)
+		db.Tables = append(db.Tables, table)
+	}
+	return db, nil
+}
+
+// Tables are only loaded here : they must have been built beforehand with the
+// pdb build command, as building them can take minutes
+func GetPatternDatabase(size int, disposition string, partition string, logger Logger) (db *PatternDatabase, err error) {
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	filename := PatternDatabaseFile(size, disposition, partition)
+	pdbCache.Lock()
+	defer pdbCache.Unlock()
+	if db, ok := pdbCache.dbs[filename]; ok {
+		return db, nil
+	}
+	if db, err = LoadPatternDatabase(filename); err != nil {
+		return nil, fmt.Errorf("No usable pattern database (%s). Build it with : pdb build -s %d -dispo %s -p %s", err.Error(), size, disposition, partition)
+	}
+	if db.Size != size || db.Disposition != disposition || db.Partition() != partition {
+		return nil, fmt.Errorf("Pattern database [%s] was built for size %d, disposition %s and partition %s", filename, db.Size, db.Disposition, db.Partition())
+	}
+	logger.Println("Loaded pattern database from", filename)
+	pdbCache.dbs[filename] = db
+	return db, nil
+}
+
+// Checks admissibility on random boards : the heuristic must never exceed the
+// length of an optimal solution found with IDA* and manhattan + linear conflict.
+// Boards whose solve takes longer than timeout, when positive, are skipped
+func VerifyPatternDatabase(db *PatternDatabase, samples int, timeout time.Duration, logger Logger) (violations int, skipped int) {
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	var reference Eval
+	for _, current := range Evals {
+		if current.Name == "astar_manhattan_conflict" {
+			reference = current
+		}
+	}
+	for i := 0; i < samples; i++ {
+		board := GridGenerator(db.Size, db.Disposition)
+		param := AlgoParameters{Board: board, Disposition: db.Disposition, Eval: reference}
+		result := func() Result {
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			data := initDataIDA(param)
+			return iterateIDA(ctx, &data)
+		}()
+		heuristic := db.Heuristic([]byte(BoardToState(board)))
+		if result.Interrupted != nil {
+			logger.Printf("[%d/%d] Board %v : heuristic %d, skipped as unsolved after %s\n", i+1, samples, board, heuristic, timeout)
+			skipped++
+			continue
+		}
+		logger.Printf("[%d/%d] Board %v : heuristic %d, optimal %d\n", i+1, samples, board, heuristic, len(result.Path))
+		if heuristic > len(result.Path) {
+			violations++
+		}
+	}
+	return violations, skipped
+}
+
+func preparePatternDatabase(param *AlgoParameters) (eval Eval, err error) {
+	size := len(param.Board)
+	partition := param.Partition
+	if partition == "" {
+		if partition = DefaultPartitions[size]; partition == "" {
+			return eval, fmt.Errorf("No default pattern database partition for size %d", size)
+		}
+	}
+	db, err := GetPatternDatabase(size, param.Disposition, partition, param.logger())
+	if err != nil {
+		return eval, err
+	}
+	eval.Fx = func(pos, startPos, goalPos [][]int, path []byte) int {
+		return len(path) + 1 + db.Heuristic([]byte(BoardToState(pos)))
+	}
+	eval.Tiles = tileEvalGenerator(1, false, Heuristic{Full: func(tiles []byte, goal *GoalTable) int {
+		return db.Heuristic(tiles)
+	}})
+	return eval, nil
+}
@@ -0,0 +1,124 @@
+package algo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRankPositions(t *testing.T) {
+	seen := map[int]bool{}
+	cells := 5
+	for a := 0; a < cells; a++ {
+		for b := 0; b < cells; b++ {
+			if a == b {
+				continue
+			}
+			rank := rankPositions([]int{a, b}, cells)
+			if rank < 0 || rank >= partialPermutationCount(cells, 2) || seen[rank] {
+				t.Errorf("rankPositions(%v) = %d", []int{a, b}, rank)
+			}
+			seen[rank] = true
+		}
+	}
+}
+
+func TestParsePartition(t *testing.T) {
+	if groups, err := parsePartition(4, "6-6-3"); err != nil || len(groups) != 3 || groups[2][0] != 13 {
+		t.Errorf("parsePartition(6-6-3) = %v, %v", groups, err)
+	}
+	if _, err := parsePartition(4, "7-8"); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("parsePartition(7-8) = %v instead of the memory limit", err)
+	}
+	if _, err := parsePartition(3, "8"); err == nil || !strings.Contains(err.Error(), "between 1 and 7") {
+		t.Errorf("parsePartition(8) = %v instead of the group size limit", err)
+	}
+	if _, err := parsePartition(6, "7-7-7-7-7"); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("parsePartition(7-7-7-7-7) = %v on a 6x6 board", err)
+	}
+	if _, err := parsePartition(5, DefaultPartitions[5]); err != nil {
+		t.Errorf("parsePartition(%s) = %v", DefaultPartitions[5], err)
+	}
+	if _, err := parsePartition(4, "6-6"); err == nil {
+		t.Errorf("parsePartition(6-6) accepted a partition missing tiles")
+	}
+}
+
+func TestPatternDatabaseAdmissible(t *testing.T) {
+	for _, disposition := range []string{"snail", "zerolast"} {
+		db, err := BuildPatternDatabase(3, disposition, DefaultPartitions[3], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goal := Goal(3, disposition)
+		if got := db.Heuristic([]byte(BoardToState(goal))); got != 0 {
+			t.Errorf("[%s] Heuristic([]byte(BoardToState(goal))) = %d", disposition, got)
+		}
+		filename := filepath.Join(t.TempDir(), "pdb.bin")
+		if err := db.Save(filename); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadPatternDatabase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Disposition != disposition || loaded.Partition() != DefaultPartitions[3] {
+			t.Errorf("LoadPatternDatabase(%s) = %s %s", filename, loaded.Disposition, loaded.Partition())
+		}
+		for i := 0; i < 20; i++ {
+			board := GridGenerator(3, disposition)
+			param := AlgoParameters{Board: board, Disposition: disposition, Eval: evalByName(t, "astar_manhattan_conflict")}
+			data := initDataIDA(param)
+			result := iterateIDA(context.Background(), &data)
+			if got := loaded.Heuristic([]byte(BoardToState(board))); got > len(result.Path) {
+				t.Errorf("[%s] Heuristic(%v) = %d with an optimal solution of %d moves", disposition, board, got, len(result.Path))
+			}
+		}
+	}
+}
+
+func TestVerifyPatternDatabase(t *testing.T) {
+	db, err := BuildPatternDatabase(3, "snail", DefaultPartitions[3], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if violations, skipped := VerifyPatternDatabase(db, 3, 0, nil); violations != 0 || skipped != 0 {
+		t.Errorf("VerifyPatternDatabase() = %d violations, %d skipped", violations, skipped)
+	}
+	if db, err = BuildPatternDatabase(4, "snail", "3-3-3-3-3", nil); err != nil {
+		t.Fatal(err)
+	}
+	if violations, skipped := VerifyPatternDatabase(db, 10, time.Millisecond, nil); violations != 0 || skipped == 0 {
+		t.Errorf("VerifyPatternDatabase() = %d violations, %d skipped past a 1ms timeout on 4x4 boards", violations, skipped)
+	}
+}
+
+func TestPatternDatabaseChecksum(t *testing.T) {
+	db, err := BuildPatternDatabase(3, "zerolast", "2-3-3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "pdb.bin")
+	if err := db.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(filename)
+	content[len(content)/2] ^= 1
+	os.WriteFile(filename, content, 0644)
+	if _, err := LoadPatternDatabase(filename); err == nil {
+		t.Errorf("LoadPatternDatabase accepted a corrupted file")
+	}
+}
+
+func evalByName(t *testing.T, name string) Eval {
+	for _, current := range Evals {
+		if current.Name == name {
+			return current
+		}
+	}
+	t.Fatalf("No heuristic named %s", name)
+	return Eval{}
+}
@@ -0,0 +1,128 @@
+package algo
+
+import (
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot of a running search. Bound is the current f-bound : the cut off of
+// IDA*, or the score of the last node expanded by the best-first searches.
+// Open is the depth of the search stack for IDA*. RAMUsed is the heap of the
+// whole process, in bytes
+type Progress struct {
+	Nodes   int           `json:"nodes"`
+	Bound   int           `json:"bound"`
+	Open    int           `json:"open"`
+	Closed  int           `json:"closed"`
+	RAMUsed uint64        `json:"ramUsed"`
+	Elapsed time.Duration `json:"elapsedNs"`
+	Done    bool          `json:"done"`
+}
+
+// Counters updated by the solvers on their periodic checks, read by the
+// progress reporter. A nil *progressCounters ignores the updates
+type progressCounters struct {
+	nodes  int64
+	bound  int64
+	open   int64
+	closed int64
+}
+
+func (counters *progressCounters) addNodes(nodes int) {
+	if counters != nil {
+		atomic.AddInt64(&counters.nodes, int64(nodes))
+	}
+}
+
+func (counters *progressCounters) setBound(bound int) {
+	if counters != nil {
+		atomic.StoreInt64(&counters.bound, int64(bound))
+	}
+}
+
+func (counters *progressCounters) setSizes(open, closed int) {
+	if counters != nil {
+		atomic.StoreInt64(&counters.open, int64(open))
+		atomic.StoreInt64(&counters.closed, int64(closed))
+	}
+}
+
+// Workers owning a part of the sets add the change of their own sizes
+func (counters *progressCounters) addSizes(open, closed int) {
+	if counters != nil {
+		atomic.AddInt64(&counters.open, int64(open))
+		atomic.AddInt64(&counters.closed, int64(closed))
+	}
+}
+
+// Bytes of the live and not yet swept heap objects, the HeapAlloc of
+// runtime.MemStats. runtime/metrics reads it without stopping the world
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+func (counters *progressCounters) snapshot(start time.Time) Progress {
+	return Progress{
+		Nodes:   int(atomic.LoadInt64(&counters.nodes)),
+		Bound:   int(atomic.LoadInt64(&counters.bound)),
+		Open:    int(atomic.LoadInt64(&counters.open)),
+		Closed:  int(atomic.LoadInt64(&counters.closed)),
+		RAMUsed: heapBytes(),
+		Elapsed: time.Since(start),
+	}
+}
+
+// Sends a snapshot to sink every interval until stop is closed. The
+// returned channel is closed once the reporter is done
+func reportProgress(counters *progressCounters, sink func(Progress), interval time.Duration, start time.Time, stop <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sink(counters.snapshot(start))
+			}
+		}
+	}()
+	return done
+}
+
+// Time between two samples of the heap while a solve runs
+const peakMemoryInterval = 100 * time.Millisecond
+
+// Samples the heap every interval until stop is closed, then sends the
+// highest sample. Like RAMUsed, it is the heap of the whole process
+func samplePeakMemory(interval time.Duration, stop <-chan struct{}) <-chan uint64 {
+	peak := make(chan uint64, 1)
+	go func() {
+		var max uint64
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if heap := heapBytes(); heap > max {
+				max = heap
+			}
+			select {
+			case <-stop:
+				if heap := heapBytes(); heap > max {
+					max = heap
+				}
+				peak <- max
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return peak
+}
@@ -2,11 +2,9 @@ package algo
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"os"
-	"runtime/debug"
-	"strconv"
 	"strings"
 	"time"
 
@@ -16,8 +14,13 @@ import (
 func InitOptionForApiUse(opt *Option, algo string) {
 	opt.DisableUI = true
 	opt.Heuristic = "astar_manhattan_conflict"
-	if algo == "A*" {
-		opt.NoIterativeDepth = true
+	switch algo {
+	case "A*":
+		opt.Algo = "astar"
+	case "MM":
+		opt.Algo = "bidir"
+	default:
+		opt.Algo = "ida"
 	}
 	opt.Workers = 8
 	opt.SeenNodesSplit = 96
@@ -27,18 +30,39 @@ func InitOptionForApiUse(opt *Option, algo string) {
 }
 
 func areFlagsOk(opt *Option) (err error) {
+	if opt.Algo == "" && opt.NoIterativeDepth {
+		opt.Algo = "astar"
+	} else if opt.Algo == "" {
+		opt.Algo = "ida"
+	}
+	if opt.Algo != "astar" && opt.Algo != "ida" && opt.Algo != "bidir" && opt.Algo != "arastar" {
+		return errors.New("Invalid algo")
+	}
+	if opt.Epsilon != 0 && (opt.Epsilon < 1 || opt.Epsilon > 10) {
+		return errors.New("Invalid epsilon (must be between 1 and 10)")
+	}
+	if opt.Deadline < 0 {
+		return errors.New("Invalid deadline")
+	}
+	if opt.Timeout < 0 {
+		return errors.New("Invalid timeout")
+	}
+	opt.NoIterativeDepth = opt.Algo == "astar"
 	if opt.Workers < 1 || opt.Workers > 32 {
 		return errors.New("Invalid number of workers")
 	}
 	if opt.SeenNodesSplit < 1 || opt.SeenNodesSplit > 96 {
 		return errors.New("Invalid number of splits")
 	}
-	if opt.Filename == "" && opt.StringInput == "" && (opt.MapSize < 3 || opt.MapSize > 4) {
+	if opt.Filename == "" && opt.StringInput == "" && (opt.MapSize < MinMapSize || opt.MapSize > MaxMapSize) {
 		return errors.New("Invalid map size")
 	}
 	if opt.RAMMaxGB < 1 || opt.RAMMaxGB > 64 {
 		return errors.New("Invalid Max Ram GB (must be between 1 and 32GB")
 	}
+	if opt.TTShare < 0 || opt.TTShare > 0.9 {
+		return errors.New("Invalid transposition table share (must be between 0 and 0.9)")
+	}
 	if opt.Disposition != "snail" && opt.Disposition != "zerolast" {
 		return errors.New("Invalid disposition")
 	}
@@ -51,25 +75,19 @@ func areFlagsOk(opt *Option) (err error) {
 }
 
 func setParam(opt *Option, param *AlgoParameters) (err error) {
+	logger := param.logger()
 	param.Workers = opt.Workers
 	param.SeenNodesSplit = opt.SeenNodesSplit
 	param.Disposition = opt.Disposition
+	param.Partition = opt.Partition
 	for _, current := range Evals {
 		if current.Name == opt.Heuristic {
 			param.Eval = current
 			break
 		}
 	}
-	if !opt.Debug {
-		os.Stderr.Close()
-		newstderr, err := os.Open(os.DevNull)
-		if err != nil {
-			return err
-		}
-		os.Stderr = newstderr
-	}
 	if opt.Filename != "" {
-		fmt.Fprintln(os.Stderr, "Opening user provided map in file", opt.Filename)
+		logger.Println("Opening user provided map in file", opt.Filename)
 		opt.Fd, err = OpenFile(opt.Filename)
 		if err != nil {
 			return err
@@ -78,11 +96,11 @@ func setParam(opt *Option, param *AlgoParameters) (err error) {
 		param.Board, err = ParseInput(scanner)
 		opt.Fd.Close()
 	} else if opt.StringInput != "" {
-		fmt.Fprintln(os.Stderr, "Reading from provided string", opt.StringInput)
+		logger.Println("Reading from provided string", opt.StringInput)
 		scanner := bufio.NewScanner(strings.NewReader(opt.StringInput))
 		param.Board, err = ParseInput(scanner)
 	} else if opt.MapSize > 0 {
-		fmt.Fprintln(os.Stderr, "Generating a map with size", opt.MapSize)
+		logger.Println("Generating a map with size", opt.MapSize)
 		param.Board = GridGenerator(opt.MapSize, param.Disposition)
 	} else {
 		return errors.New("No valid filename, stringMap or mapSize")
@@ -90,72 +108,192 @@ func setParam(opt *Option, param *AlgoParameters) (err error) {
 	if err != nil {
 		return err
 	}
+	if opt.Algo == "bidir" && param.Eval.Prepare != nil {
+		return fmt.Errorf("Heuristic %s can not be measured against the start board by the bidirectional search", param.Eval.Name)
+	}
+	if param.Eval.Prepare != nil {
+		prepared, err := param.Eval.Prepare(param)
+		if err != nil {
+			return err
+		}
+		prepared.Name = param.Eval.Name
+		param.Eval = prepared
+	}
+	param.Epsilon = opt.Epsilon
+	param.Deadline = opt.Deadline
+	// Epsilon, ARA* and MM weigh the heuristic parts of Tiles : Fx can not be
+	// weighed
+	if param.Eval.Tiles == nil && (opt.Algo == "arastar" || opt.Algo == "bidir" || param.Epsilon > 1) {
+		return fmt.Errorf("Heuristic %s has no tile evaluation to weigh : use it with A* or IDA* and no epsilon", param.Eval.Name)
+	}
+	// ARA* weighs the heuristic with its own epsilon
+	if opt.Algo == "arastar" && param.Eval.Tiles.Bound() != 1 {
+		return fmt.Errorf("Heuristic %s is greedy or weighted : ARA* only takes a heuristic of weight 1 and weighs it with epsilon", param.Eval.Name)
+	}
+	if opt.Algo == "arastar" && param.Epsilon == 0 {
+		param.Epsilon = DefaultARAEpsilon
+	} else if opt.Algo != "arastar" && param.Epsilon > 1 {
+		param.Eval.Tiles = param.Eval.Tiles.Inflate(param.Epsilon)
+	}
+	// The stopping rule of MM only proves the path optimal with g + 1 + h
+	// scores
+	if opt.Algo == "bidir" && param.Eval.Tiles.Bound() != 1 {
+		return fmt.Errorf("Heuristic %s with epsilon %.2f is not admissible : the bidirectional search only finds optimal paths", param.Eval.Name, param.Epsilon)
+	}
 	if ok, _ := IsSolvable(param.Board, param.Disposition); !ok {
-		fmt.Fprintln(os.Stderr, "Board is not solvable")
+		logger.Println("Board is not solvable")
 		param.Unsolvable = true
 		return errors.New("Board is not solvable")
 	}
 	param.RAMMaxGB = opt.RAMMaxGB
-	if opt.RAMMaxGB > 1 && opt.NoIterativeDepth {
-		fmt.Fprintf(os.Stderr, "Solver will use a soft maxmimum of %d Gb and a hard maximum of %d Gb of RAM\n", param.RAMMaxGB-1, param.RAMMaxGB)
-		debug.SetMemoryLimit(int64((opt.RAMMaxGB - 1) << 30))
-		debug.SetGCPercent(-1)
-	} else {
-		fmt.Fprintf(os.Stderr, "Solver will use a soft maxmimum of %d Gb. RAM failure will be triggered if available RAM drops below %d Mb\n", param.RAMMaxGB, MinRAMAvailableMB)
-		debug.SetMemoryLimit(int64(opt.RAMMaxGB << 30))
-		debug.SetGCPercent(200)
-	}
+	param.TTShare = opt.TTShare
+	logger.Printf("Solver will use a maxmimum of %d Gb. RAM failure will be triggered if available RAM drops below %d Mb\n", param.RAMMaxGB, MinRAMAvailableMB)
 	return err
 }
 
-func displayResult(algoResult Result, opt Option, param AlgoParameters, elapsed time.Duration) {
-	fmt.Fprintln(os.Stderr, "Succes with :", param.Eval.Name, "in ", elapsed.String(), "!")
-	fmt.Fprintf(os.Stderr, "len of solution : %v, time complexity / tries : %d, space complexity : %d\n", len(algoResult.Path), algoResult.Tries, algoResult.ClosedSetComplexity)
-	if !opt.DisableUI {
-		DisplayBoard(param.Board, algoResult.Path, param.Eval.Name, elapsed.String(), algoResult.Tries, algoResult.ClosedSetComplexity, param.Workers, param.SeenNodesSplit, opt.SpeedDisplay)
-	}
+func displayResult(algoResult Result, param AlgoParameters, elapsed time.Duration) {
+	logger := param.logger()
+	logger.Println("Succes with :", param.Eval.Name, "in ", elapsed.String(), "!")
+	logger.Printf("len of solution : %v, time complexity / tries : %d, space complexity : %d, suboptimality bound : %.2f\n", len(algoResult.Path), algoResult.Tries, algoResult.ClosedSetComplexity, algoResult.Bound)
 }
 
 func generateSolutionEntity(param AlgoParameters, algoResult Result, elapsed time.Duration) *models.Solution {
 	solution := models.Solution{
-		Size:        len(param.Board),
-		Hash:        MatrixToStringHashOnly(param.Board, "."),
-		Path:        string(algoResult.Path),
-		Length:      len(algoResult.Path),
-		Algo:        algoResult.Algo,
-		Solvable:    true,
-		Workers:     param.Workers,
-		Split:       param.SeenNodesSplit,
-		Disposition: param.Disposition,
-		ComputeMs:   elapsed.Microseconds(),
+		Size:          len(param.Board),
+		Hash:          MatrixToStringHashOnly(param.Board, "."),
+		Path:          string(algoResult.Path),
+		Length:        len(algoResult.Path),
+		Algo:          algoResult.Algo,
+		Solvable:      true,
+		Workers:       param.Workers,
+		Split:         param.SeenNodesSplit,
+		Disposition:   param.Disposition,
+		ComputeMs:     elapsed.Microseconds(),
+		Bound:         algoResult.Bound,
+		Heuristic:     param.Eval.Name,
+		Nodes:         algoResult.Tries,
+		PeakMemory:    algoResult.PeakMemory,
+		Optimal:       algoResult.Bound == 1,
+		SolverVersion: SolverVersion,
 	}
 	return &solution
 }
 
-func Solve(opt *Option) (result [3]string, solution *models.Solution) {
-	param := AlgoParameters{}
+// Solves the board described by its options. A Solver only writes to its
+// logger : it leaves the process settings such as the memory limit to its
+// caller, and solvers may run concurrently
+type Solver struct {
+	option           Option
+	logger           Logger
+	progress         func(Progress)
+	progressInterval time.Duration
+}
+
+type SolverOption func(*Solver)
+
+// Messages of the solve, discarded by default
+func WithLogger(logger Logger) SolverOption {
+	return func(solver *Solver) {
+		solver.logger = logger
+	}
+}
+
+// Snapshots of the search sent every interval from another goroutine, then
+// a last one marked Done once the search is over
+func WithProgress(interval time.Duration, sink func(Progress)) SolverOption {
+	return func(solver *Solver) {
+		solver.progress = sink
+		solver.progressInterval = interval
+	}
+}
+
+func NewSolver(opt Option, options ...SolverOption) *Solver {
+	solver := &Solver{option: opt}
+	for _, option := range options {
+		option(solver)
+	}
+	return solver
+}
+
+// Solving stops with a StatusCancelled or StatusTimeout outcome once ctx is
+// done, or once the Timeout option is passed. The solution is only returned
+// with StatusOK. Solve may be called again, or from several goroutines
+func (solver *Solver) Solve(ctx context.Context) (outcome SolveOutcome, solution *models.Solution) {
+	opt := solver.option
+	param := AlgoParameters{Logger: solver.logger}
 	algoResult := Result{}
-	if err := areFlagsOk(opt); err != nil {
-		return [3]string{"FLAGS", err.Error()}, nil
+	if err := areFlagsOk(&opt); err != nil {
+		return SolveOutcome{Status: StatusInvalidFlags, Error: err.Error()}, nil
 	}
-	if err := setParam(opt, &param); err != nil {
-		return [3]string{"PARAM", err.Error()}, nil
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
 	}
-	fmt.Fprintf(os.Stderr, "Board is : %v\nNow starting with : %v\n", param.Board, param.Eval.Name)
+	if err := setParam(&opt, &param); err != nil {
+		return SolveOutcome{Status: StatusInvalidParam, Heuristic: opt.Heuristic, Error: err.Error()}, nil
+	}
+	param.logger().Printf("Board is : %v\nNow starting with : %v\n", param.Board, param.Eval.Name)
 	start := time.Now()
-	if opt.NoIterativeDepth {
+	if solver.progress != nil && solver.progressInterval > 0 {
+		param.Progress = &progressCounters{}
+		stop := make(chan struct{})
+		done := reportProgress(param.Progress, solver.progress, solver.progressInterval, start, stop)
+		defer func() {
+			close(stop)
+			<-done
+			last := param.Progress.snapshot(start)
+			last.Nodes, last.Done = outcome.Nodes, true
+			solver.progress(last)
+		}()
+	}
+	stopSampling := make(chan struct{})
+	peakMemory := samplePeakMemory(peakMemoryInterval, stopSampling)
+	switch {
+	case opt.Algo == "astar":
 		data := initData(param)
-		algoResult = launchAstarWorkers(param, &data)
-	} else {
+		algoResult = launchAstarWorkers(ctx, param, &data)
+	case opt.Algo == "bidir":
+		algoResult = launchBidirectional(ctx, param)
+	case opt.Algo == "arastar":
+		algoResult = launchARAStar(ctx, param)
+	case param.Workers > 1:
+		algoResult = launchIDAWorkers(ctx, param)
+	default:
 		data := initDataIDA(param)
-		algoResult = iterateIDA(&data)
+		algoResult = iterateIDA(ctx, &data)
 	}
+	close(stopSampling)
+	algoResult.PeakMemory = <-peakMemory
 	elapsed := time.Now().Sub(start)
-	if algoResult.Path != nil {
-		displayResult(algoResult, *opt, param, elapsed)
-		return [3]string{"OK", string(algoResult.Path), elapsed.String()}, generateSolutionEntity(param, algoResult, elapsed)
-	} else if algoResult.RamFailure {
-		return [3]string{"RAM", strconv.Itoa(algoResult.ClosedSetComplexity), elapsed.String()}, nil
+	outcome = SolveOutcome{
+		Status:      StatusNoSolution,
+		Moves:       algoResult.Path,
+		Duration:    elapsed,
+		Nodes:       algoResult.Tries,
+		MaxFrontier: algoResult.MaxFrontier,
+		Heuristic:   param.Eval.Name,
+		Algorithm:   algoResult.Algo,
+		Bound:       algoResult.Bound,
+		Board:       param.Board,
+		ClosedSet:   algoResult.ClosedSetComplexity,
+	}
+	switch {
+	case algoResult.Path != nil:
+		displayResult(algoResult, param, elapsed)
+		outcome.Status = StatusOK
+		return outcome, generateSolutionEntity(param, algoResult, elapsed)
+	case algoResult.RamFailure:
+		outcome.Status = StatusRAMFailure
+		outcome.Error = fmt.Sprintf("Not enough RAM left after %d nodes in the closed set", algoResult.ClosedSetComplexity)
+	case errors.Is(algoResult.Interrupted, context.DeadlineExceeded):
+		outcome.Status = StatusTimeout
+		outcome.Error = algoResult.Interrupted.Error()
+	case algoResult.Interrupted != nil:
+		outcome.Status = StatusCancelled
+		outcome.Error = algoResult.Interrupted.Error()
+	default:
+		outcome.Error = "Search ended without a solution"
 	}
-	return [3]string{"END"}, nil
+	return outcome, nil
 }
@@ -0,0 +1,151 @@
+package algo
+
+// Symmetry of the square keeping the empty cell of the goal in place. It
+// moves the cells of a board, then renames the tiles so that the goal is
+// left unchanged : a board and its image need the same number of moves, and
+// the moves of one are the image of the moves of the other. Cells are
+// transformed around the center of the board, with coordinates doubled to
+// stay integers : X' = xx*X + xy*Y and Y' = yx*X + yy*Y
+type Symmetry struct {
+	Name           string
+	xx, xy, yx, yy int
+}
+
+var (
+	Identity      = Symmetry{"identity", 1, 0, 0, 1}
+	Rotate90      = Symmetry{"rotate90", 0, -1, 1, 0}
+	Rotate180     = Symmetry{"rotate180", -1, 0, 0, -1}
+	Rotate270     = Symmetry{"rotate270", 0, 1, -1, 0}
+	FlipLeftRight = Symmetry{"flipLeftRight", -1, 0, 0, 1}
+	FlipUpDown    = Symmetry{"flipUpDown", 1, 0, 0, -1}
+	Transpose     = Symmetry{"transpose", 0, 1, 1, 0}
+	AntiTranspose = Symmetry{"antiTranspose", 0, -1, -1, 0}
+)
+
+// Symmetries of the square, Identity first
+var dihedralSymmetries = []Symmetry{Identity, Rotate90, Rotate180, Rotate270, FlipLeftRight, FlipUpDown, Transpose, AntiTranspose}
+
+// Symmetry with this name, as found in Symmetry.Name
+func SymmetryByName(name string) (Symmetry, bool) {
+	for _, symmetry := range dihedralSymmetries {
+		if symmetry.Name == name {
+			return symmetry, true
+		}
+	}
+	return Symmetry{}, false
+}
+
+func (symmetry Symmetry) cell(pos Pos2D, size int) Pos2D {
+	x, y := 2*pos.X-(size-1), 2*pos.Y-(size-1)
+	return Pos2D{
+		X: (symmetry.xx*x + symmetry.xy*y + size - 1) / 2,
+		Y: (symmetry.yx*x + symmetry.yy*y + size - 1) / 2,
+	}
+}
+
+// Symmetry undoing this one
+func (symmetry Symmetry) Inverse() Symmetry {
+	for _, inverse := range dihedralSymmetries {
+		if inverse.xx == symmetry.xx && inverse.xy == symmetry.yx && inverse.yx == symmetry.xy && inverse.yy == symmetry.yy {
+			return inverse
+		}
+	}
+	return symmetry
+}
+
+// Image of the board by the symmetry, for the goal of this disposition
+func (symmetry Symmetry) Board(board [][]int, disposition string) [][]int {
+	size := len(board)
+	goal := Goal(size, disposition)
+	rename := make([]int, size*size)
+	for y := range goal {
+		for x, tile := range goal[y] {
+			image := symmetry.cell(Pos2D{X: x, Y: y}, size)
+			rename[tile] = goal[image.Y][image.X]
+		}
+	}
+	image := make([][]int, size)
+	for y := range image {
+		image[y] = make([]int, size)
+	}
+	for y := range board {
+		for x, tile := range board[y] {
+			cell := symmetry.cell(Pos2D{X: x, Y: y}, size)
+			image[cell.Y][cell.X] = rename[tile]
+		}
+	}
+	return image
+}
+
+// Image of the moves of the empty tile by the symmetry
+func (symmetry Symmetry) Moves(moves Moves) Moves {
+	image := make(Moves, len(moves))
+	for i, dir := range moves {
+		var x, y int
+		switch dir {
+		case 'U':
+			y = -1
+		case 'D':
+			y = 1
+		case 'L':
+			x = -1
+		case 'R':
+			x = 1
+		}
+		switch x, y = symmetry.xx*x+symmetry.xy*y, symmetry.yx*x+symmetry.yy*y; {
+		case y == -1:
+			image[i] = 'U'
+		case y == 1:
+			image[i] = 'D'
+		case x == -1:
+			image[i] = 'L'
+		default:
+			image[i] = 'R'
+		}
+	}
+	return image
+}
+
+// Symmetries keeping the goal of this disposition unchanged : the identity
+// and the transposition for zerolast, whose empty cell is a corner. All the
+// symmetries of the square for snail on odd sizes, whose empty cell is the
+// center, and the identity and the anti-transposition on even sizes
+func GoalSymmetries(size int, disposition string) []Symmetry {
+	goal := Goal(size, disposition)
+	if goal == nil {
+		return []Symmetry{Identity}
+	}
+	empty := getValuePostion(goal, 0)
+	var symmetries []Symmetry
+	for _, symmetry := range dihedralSymmetries {
+		if symmetry.cell(empty, size) == empty {
+			symmetries = append(symmetries, symmetry)
+		}
+	}
+	return symmetries
+}
+
+// Representative of the board and of its images by the symmetries of the
+// goal : the smallest one, comparing tiles row by row. The returned
+// symmetry maps the board to its representative, so that the moves of the
+// board are symmetry.Inverse().Moves(the moves of the representative)
+func Canonicalize(board [][]int, disposition string) (canonical [][]int, symmetry Symmetry) {
+	canonical, symmetry = board, Identity
+	for _, candidate := range GoalSymmetries(len(board), disposition)[1:] {
+		if image := candidate.Board(board, disposition); lessBoard(image, canonical) {
+			canonical, symmetry = image, candidate
+		}
+	}
+	return canonical, symmetry
+}
+
+func lessBoard(a, b [][]int) bool {
+	for y := range a {
+		for x := range a[y] {
+			if a[y][x] != b[y][x] {
+				return a[y][x] < b[y][x]
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package algo
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Board reached by the moves, nil if one of them leaves the board
+func playMoves(board [][]int, moves Moves) [][]int {
+	for _, dir := range moves {
+		var ok bool
+		switch dir {
+		case 'U':
+			ok, board = moveUp(board)
+		case 'D':
+			ok, board = moveDown(board)
+		case 'L':
+			ok, board = moveLeft(board)
+		case 'R':
+			ok, board = moveRight(board)
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return board
+}
+
+func TestGoalSymmetries(t *testing.T) {
+	test := []struct {
+		size        int
+		disposition string
+		want        []Symmetry
+	}{
+		{3, "zerolast", []Symmetry{Identity, Transpose}},
+		{4, "zerolast", []Symmetry{Identity, Transpose}},
+		{3, "snail", dihedralSymmetries},
+		{4, "snail", []Symmetry{Identity, AntiTranspose}},
+		{5, "snail", dihedralSymmetries},
+	}
+	for _, test := range test {
+		symmetries := GoalSymmetries(test.size, test.disposition)
+		if len(symmetries) != len(test.want) {
+			t.Errorf("GoalSymmetries(%d, %s) = %v", test.size, test.disposition, symmetries)
+			continue
+		}
+		for i, symmetry := range symmetries {
+			goal := Goal(test.size, test.disposition)
+			if symmetry != test.want[i] || !isEqual(symmetry.Board(goal, test.disposition), goal) {
+				t.Errorf("GoalSymmetries(%d, %s) = %v", test.size, test.disposition, symmetries)
+			}
+		}
+	}
+}
+
+// The image of a board after some moves is the image of the board after the
+// image of the moves : paths translate through the symmetries
+func TestSymmetryMoves(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	for _, size := range []int{3, 4, 5} {
+		for _, disposition := range []string{"snail", "zerolast"} {
+			for _, symmetry := range GoalSymmetries(size, disposition) {
+				board := GridGenerator(size, disposition)
+				image := symmetry.Board(board, disposition)
+				if back := symmetry.Inverse().Board(image, disposition); !isEqual(back, board) {
+					t.Errorf("%s of %v undone as %v", symmetry.Name, board, back)
+				}
+				after, moves := board, Moves{}
+				for len(moves) < 30 {
+					dir := "UDLR"[random.Intn(4)]
+					if next := playMoves(after, Moves{dir}); next != nil {
+						after, moves = next, append(moves, dir)
+					}
+				}
+				if imageAfter := playMoves(image, symmetry.Moves(moves)); imageAfter == nil || !isEqual(symmetry.Board(after, disposition), imageAfter) {
+					t.Errorf("%s of %v does not commute with %s", symmetry.Name, board, moves)
+				}
+			}
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	for _, disposition := range []string{"snail", "zerolast"} {
+		for i := 0; i < 20; i++ {
+			board := GridGenerator(3, disposition)
+			canonical, symmetry := Canonicalize(board, disposition)
+			if !isEqual(symmetry.Board(board, disposition), canonical) {
+				t.Errorf("Canonicalize(%v) = %v, %s", board, canonical, symmetry.Name)
+			}
+			for _, other := range GoalSymmetries(3, disposition) {
+				if image, _ := Canonicalize(other.Board(board, disposition), disposition); !isEqual(image, canonical) {
+					t.Errorf("%s of %v has representative %v instead of %v", other.Name, board, image, canonical)
+				}
+			}
+		}
+	}
+}
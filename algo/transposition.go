@@ -0,0 +1,38 @@
+package algo
+
+import "sync/atomic"
+
+// Bounded transposition table for IDA*, shared by all workers without locks.
+// An entry holds the smallest depth at which a state was reached during the
+// current cut off. Both words are written separately and the first one is
+// the hash xored with the second : a torn entry fails the check and is
+// treated as empty
+type transpositionTable struct {
+	entries [][2]uint64
+	mask    uint64
+}
+
+func newTranspositionTable(maxBytes uint64) *transpositionTable {
+	size := uint64(1)
+	for size*2*16 <= maxBytes {
+		size *= 2
+	}
+	return &transpositionTable{entries: make([][2]uint64, size), mask: size - 1}
+}
+
+// Whether the subtree of a state reached at this depth must be searched : it
+// was not already reached at the same or a lower depth during this cut off.
+// A pruned subtree offers nothing that the earlier one did not
+func (table *transpositionTable) visit(hash uint64, depth int, cutOff int) bool {
+	entry := &table.entries[hash&table.mask]
+	value := uint64(depth)<<32 | uint64(uint32(cutOff))
+	stored := atomic.LoadUint64(&entry[1])
+	if atomic.LoadUint64(&entry[0])^stored == hash &&
+		uint32(stored) == uint32(cutOff) &&
+		int(stored>>32) <= depth {
+		return false
+	}
+	atomic.StoreUint64(&entry[1], value)
+	atomic.StoreUint64(&entry[0], hash^value)
+	return true
+}
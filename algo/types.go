@@ -3,6 +3,7 @@ package algo
 import (
 	"os"
 	"sync"
+	"time"
 )
 
 type Move2D struct {
@@ -16,33 +17,47 @@ type Pos2D struct {
 	Y int
 }
 
-// path could be replaced with [5]uint64 (80moves of 2bit) + uint8 for len of path
+// State is a compact, comparable encoding of a board usable as a map key.
+// Each tile is stored on one byte in row-major order, which supports boards
+// up to MaxMapSize x MaxMapSize.
+type State string
+
+// Moves are shared between nodes : a node only allocates its last move and
+// points to the moves of its parent
+type pathNode struct {
+	parent *pathNode
+	dir    byte
+}
+
+// h is the unweighted heuristic value, kept for incremental evaluations, and
+// empty the cell of the empty tile
 type Node struct {
-	world uint64
-	path  []byte
+	world State
+	hash  uint64
+	path  *pathNode
+	depth uint16
 	score uint16
+	h     uint16
+	empty uint8
 }
 
-func BoardToUint64(board [][]int) (res uint64) {
+func BoardToState(board [][]int) State {
 	size := len(board)
+	res := make([]byte, size*size)
 	for i := 0; i < size; i++ {
 		for j := 0; j < size; j++ {
-			res |= uint64(board[i][j])
-			if i != size-1 || j != size-1 {
-				res <<= 4
-			}
+			res[i*size+j] = byte(board[i][j])
 		}
 	}
-	return
+	return State(res)
 }
 
-func Uint64ToBoard(flat uint64, size int) (board [][]int) {
+func StateToBoard(state State, size int) (board [][]int) {
 	board = make([][]int, size)
-	for i := size - 1; i >= 0; i-- {
+	for i := 0; i < size; i++ {
 		board[i] = make([]int, size)
-		for j := size - 1; j >= 0; j-- {
-			board[i][j] = int(flat & 15)
-			flat >>= 4
+		for j := 0; j < size; j++ {
+			board[i][j] = int(state[i*size+j])
 		}
 	}
 	return
@@ -52,9 +67,50 @@ type moveFx func([][]int) (bool, [][]int)
 
 type EvalFx func(pos, startPos, goalPos [][]int, path []byte) int
 
+// GoalTable gives in constant time the goal row and column of each tile
+type GoalTable struct {
+	Size int
+	Row  []int
+	Col  []int
+}
+
+func NewGoalTable(goal [][]int) *GoalTable {
+	size := len(goal)
+	table := &GoalTable{Size: size, Row: make([]int, size*size), Col: make([]int, size*size)}
+	for i, row := range goal {
+		for j, value := range row {
+			table.Row[value] = i
+			table.Col[value] = j
+		}
+	}
+	return table
+}
+
+// A Heuristic works on a flat board, one byte per tile in row-major order.
+// Delta, when set, returns how the heuristic changes when tile moved from cell
+// `from` to cell `to`, tiles being the board after the move. Without Delta,
+// Full is computed again on every board
+type Heuristic struct {
+	Full  func(tiles []byte, goal *GoalTable) int
+	Delta func(tiles []byte, goal *GoalTable, tile byte, from, to int) int
+}
+
+// TileEval is the incremental form of an EvalFx : the heuristic value of a
+// board is the sum of its parts and is updated from the parent's value
+type TileEval struct {
+	Parts  []Heuristic
+	Weight float64
+	Greedy bool
+}
+
+// Prepare, when set, builds the evaluation for the board to solve before
+// solving (ex : loading precomputed tables). Tiles, when set, is used instead
+// of Fx by the solvers
 type Eval struct {
-	Name string
-	Fx   EvalFx
+	Name    string
+	Fx      EvalFx
+	Prepare func(param *AlgoParameters) (Eval, error)
+	Tiles   *TileEval
 }
 
 type Option struct {
@@ -66,11 +122,18 @@ type Option struct {
 	SeenNodesSplit   int
 	SpeedDisplay     int
 	NoIterativeDepth bool
+	Algo             string
 	Debug            bool
 	DisableUI        bool
 	StringInput      string
 	RAMMaxGB         uint64
 	Disposition      string
+	Partition        string
+	TTShare          float64
+	Epsilon          float64
+	Deadline         time.Duration
+	Timeout          time.Duration
+	Verify           string
 }
 
 type Result struct {
@@ -79,38 +142,73 @@ type Result struct {
 	Tries               int
 	RamFailure          bool
 	Algo                string
+	Bound               float64
+	Interrupted         error
+	MaxFrontier         int
+	PeakMemory          uint64
 }
 
+// Board is the current board of the search, moved in place. Hashes and H
+// hold the zobrist hash and heuristic value of every board of the path
 type idaData struct {
 	Fx                  EvalFx
+	Tiles               *TileEval
+	GoalTable           *GoalTable
 	MaxScore            int
 	Path                []byte
-	States              [][][]int
+	Board               []byte
+	Empty               int
+	Size                int
 	Hashes              []uint64
+	H                   []int
 	Goal                [][]int
+	GoalState           State
 	ClosedSetComplexity int
 	Tries               int
 	RamFailure          bool
+	Stop                *int32
+	Interrupted         error
+	Table               *transpositionTable
+	Logger              Logger
+	Progress            *progressCounters
 }
 
-type safeData struct {
-	MuQueue  []sync.Mutex
-	PosQueue []*PriorityQueue
+// Each A* worker owns the states whose zobrist hash falls in its partition :
+// only the owner touches its queue and closed set, other workers send it
+// nodes through its inbox. Sent, Received and Idle are read by the
+// termination detection
+type astarWorker struct {
+	MuInbox sync.Mutex
+	Inbox   []Node
+
+	Queue    PriorityQueue
+	Seen     map[State]int
+	Sent     int64
+	Received int64
+	Idle     int32
+
+	Tries          int
+	MaxSizeQueue   int
+	CreatedNodes   int
+	ExpandedDepths int
+	ReportedOpen   int
+	ReportedClosed int
+}
 
-	MuSeen       []sync.Mutex
-	SeenNodes    []map[uint64]int
-	Tries        int
-	MaxSizeQueue []int
+type safeData struct {
+	Workers    []astarWorker
+	Over       int32
+	RamFailure int32
+	Incumbent  uint32
 
 	Mu                  sync.Mutex
 	Path                []byte
-	Over                bool
 	Win                 bool
-	RamFailure          bool
 	WinScore            uint16
-	Idle                int
+	Tries               int
 	ClosedSetComplexity int
 	RAMMin              uint64
+	Interrupted         error
 }
 
 type AlgoParameters struct {
@@ -121,4 +219,10 @@ type AlgoParameters struct {
 	Unsolvable     bool
 	RAMMaxGB       uint64
 	Disposition    string
+	Partition      string
+	TTShare        float64
+	Epsilon        float64
+	Deadline       time.Duration
+	Logger         Logger
+	Progress       *progressCounters
 }
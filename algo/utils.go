@@ -46,6 +46,38 @@ func DeepSliceCopyAndAdd[T any](slice []T, elems ...T) []T {
 	return newSlice
 }
 
+// Rebuilds the moves leading to a node from its last move
+func (path *pathNode) Moves(depth int) []byte {
+	moves := make([]byte, depth)
+	for i := depth - 1; i >= 0 && path != nil; i-- {
+		moves[i] = path.dir
+		path = path.parent
+	}
+	return moves
+}
+
+func (path *pathNode) Last() byte {
+	if path == nil {
+		return 0
+	}
+	return path.dir
+}
+
+// Estimates the memory of a slice of n bytes : header and Go allocator size class
+func sliceBytes(n int) int {
+	header := 24
+	switch {
+	case n == 0:
+		return header
+	case n <= 32:
+		return header + (n+7)/8*8
+	case n <= 256:
+		return header + (n+15)/16*16
+	default:
+		return header + (n+31)/32*32
+	}
+}
+
 func Deep2DSliceCopy[T any](slice [][]T) [][]T {
 	newSlice := make([][]T, len(slice))
 	for i, row := range slice {
@@ -100,81 +132,3 @@ func MatrixToStringHashOnly(matrix [][]int, separator string) string {
 	}
 	return results
 }
-
-/*
-func MatrixToStringSelector(matrix [][]int, worker int, seenNodeMap int) (key string, queueIndex int, seenNodeIndex int) {
-	if len(matrix) < 10 {
-		return matrixToStringOptimal(matrix, worker, seenNodeMap)
-	} else {
-		return MatrixToStringNoOpti(matrix, worker, seenNodeMap)
-	}
-}
-*/
-
-func MatrixToStringSelector(matrix [][]int, worker int, seenNodeMap int) (key uint64, queueIndex int, seenNodeIndex int) {
-		return matrixToUint64(matrix, worker, seenNodeMap)
-}
-
-//TODO fx to change for 3x3 or 4x4
-func matrixToUint64(matrix [][]int, worker int, seenNodeMap int) (key uint64, queueIndex int, seenNodeIndex int) {
-
-	size := len(matrix)
-
-	spot := 0
-	for i := 0; i < size; i++ {
-
-		for j := 0; j < size; j++ {
-			queueIndex += matrix[i][j] * (i + 0) * (j + 0)
-			seenNodeIndex += matrix[i][j] * (i + 0) * (j + 0)
-			spot += 3
-			key |= uint64(matrix[i][j])
-			if i != 3 || j != 3 {
-				key <<= 4
-			}
-		}
-	}
-	queueIndex %= worker
-	seenNodeIndex %= seenNodeMap
-	return key, queueIndex, seenNodeIndex
-}
-
-func matrixToStringOptimal(matrix [][]int, worker int, seenNodeMap int) (key string, queueIndex int, seenNodeIndex int) {
-
-	results := make([]byte, len(matrix)*len(matrix)*4)
-	size := len(matrix)
-
-	spot := 0
-	for i := 0; i < size; i++ {
-
-		for j := 0; j < size; j++ {
-			queueIndex += matrix[i][j] * (i + 0) * (j + 0)
-			seenNodeIndex += matrix[i][j] * (i + 0) * (j + 0)
-			results[spot] = byte(matrix[i][j] / 10)
-			results[spot+1] = byte(matrix[i][j] % 10)
-			results[spot+2] = '.'
-			spot += 3
-		}
-	}
-	queueIndex %= worker
-	seenNodeIndex %= seenNodeMap
-	return string(results), queueIndex, seenNodeIndex
-}
-
-func MatrixToStringNoOpti(matrix [][]int, worker int, seenNodeMap int) (key string, queueIndex int, seenNodeIndex int) {
-
-	results := ""
-	size := len(matrix)
-
-	for i := 0; i < size; i++ {
-
-		for j := 0; j < size; j++ {
-			queueIndex *= matrix[i][j] * (i + 0) * (j + 0)
-			seenNodeIndex *= matrix[i][j] * (i + 0) * (j + 0)
-			results += strconv.Itoa(matrix[i][j]) + "."
-
-		}
-	}
-	queueIndex %= worker
-	seenNodeIndex %= seenNodeMap
-	return results, queueIndex, seenNodeIndex
-}
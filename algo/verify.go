@@ -0,0 +1,107 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Replay of moves on a board, played until the first illegal one. Final is
+// the board after the moves played. LowerBound is the manhattan distance
+// with linear conflicts of the board : no solution is shorter, and a
+// solution of that length is optimal. Optimal is only set once proven, by
+// the lower bound or by CheckOptimal. Error explains why the moves do not
+// solve the board
+type Verification struct {
+	Solved        bool    `json:"solved"`
+	Optimal       bool    `json:"optimal"`
+	Length        int     `json:"length"`
+	Played        int     `json:"played"`
+	IllegalMove   int     `json:"illegalMove"`
+	LowerBound    int     `json:"lowerBound"`
+	OptimalLength int     `json:"optimalLength,omitempty"`
+	Final         [][]int `json:"final"`
+	Error         string  `json:"error,omitempty"`
+}
+
+func checkBoard(board [][]int) error {
+	size := len(board)
+	if size < MinMapSize || size > MaxMapSize {
+		return fmt.Errorf("Board size %d is not between %d and %d", size, MinMapSize, MaxMapSize)
+	}
+	seen := make([]bool, size*size)
+	for _, row := range board {
+		if len(row) != size {
+			return errors.New("Board is not square")
+		}
+		for _, tile := range row {
+			if tile < 0 || tile >= size*size || seen[tile] {
+				return fmt.Errorf("Board has an invalid or duplicate tile %d", tile)
+			}
+			seen[tile] = true
+		}
+	}
+	return nil
+}
+
+// Replays the moves of the empty tile on the board, as PlayMoves does, and
+// checks that they reach the goal of the disposition
+func Verify(board [][]int, disposition string, moves Moves) (verification Verification) {
+	verification = Verification{Length: len(moves), IllegalMove: -1, Final: board}
+	if err := checkBoard(board); err != nil {
+		verification.Error = err.Error()
+		return verification
+	}
+	goal := Goal(len(board), disposition)
+	if goal == nil {
+		verification.Error = "Invalid disposition"
+		return verification
+	}
+	table := NewGoalTable(goal)
+	tiles := []byte(BoardToState(board))
+	verification.LowerBound = manhattanFull(tiles, table) + conflictFull(tiles, table)
+	for i, dir := range moves {
+		if reverseMove(dir) == 0 {
+			verification.IllegalMove = i
+			verification.Error = fmt.Sprintf("Move %d (%q) is not one of U, D, L, R", i, dir)
+			return verification
+		}
+		ok, next := moveBoard(verification.Final, dir)
+		if !ok {
+			verification.IllegalMove = i
+			verification.Error = fmt.Sprintf("Move %d (%c) leaves the board", i, dir)
+			return verification
+		}
+		verification.Final = next
+		verification.Played++
+	}
+	if !isEqual(verification.Final, goal) {
+		verification.Error = "Moves do not reach the goal"
+		return verification
+	}
+	verification.Solved = true
+	verification.Optimal = verification.Length == verification.LowerBound
+	return verification
+}
+
+// Proves or refutes that the moves of a solved verification are optimal by
+// solving the board with the solver of opt, which must be optimal. Nothing
+// is solved when the lower bound is enough
+func (verification *Verification) CheckOptimal(ctx context.Context, board [][]int, disposition string, opt Option, options ...SolverOption) error {
+	if !verification.Solved || verification.Optimal {
+		return nil
+	}
+	opt.Filename, opt.MapSize = "", 0
+	opt.StringInput = strconv.Itoa(len(board)) + " " + MatrixToStringHashOnly(board, " ")
+	opt.Disposition = disposition
+	outcome, _ := NewSolver(opt, options...).Solve(ctx)
+	if outcome.Status != StatusOK {
+		return fmt.Errorf("Optimal solve failed [%s] %s", outcome.Status, outcome.Error)
+	} else if outcome.Bound != 1 {
+		return errors.New("Solver is not optimal")
+	}
+	verification.OptimalLength = len(outcome.Moves)
+	verification.Optimal = verification.OptimalLength == verification.Length
+	return nil
+}
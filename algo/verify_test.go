@@ -0,0 +1,62 @@
+package algo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	board := [][]int{{1, 2, 3}, {0, 4, 5}, {7, 8, 6}}
+	test := []struct {
+		disposition string
+		moves       string
+		solved      bool
+		illegal     int
+	}{
+		{"zerolast", "RRD", true, -1},
+		{"zerolast", "RRDLR", true, -1},
+		{"zerolast", "RR", false, -1},
+		{"zerolast", "RRDD", false, 3},
+		{"zerolast", "L", false, 0},
+		{"zerolast", "RX", false, 1},
+		{"snail", "RRD", false, -1},
+		{"spiral", "RRD", false, -1},
+	}
+	for _, test := range test {
+		verification := Verify(board, test.disposition, Moves(test.moves))
+		if verification.Solved != test.solved || verification.IllegalMove != test.illegal || (verification.Error == "") != test.solved {
+			t.Errorf("Verify(%v, %s, %s) = %+v", board, test.disposition, test.moves, verification)
+		}
+	}
+	if verification := Verify(board, "zerolast", Moves("RRD")); !verification.Optimal || verification.LowerBound != 3 {
+		t.Errorf("Verify(%v, zerolast, RRD) = %+v instead of optimal", board, verification)
+	}
+	if verification := Verify([][]int{{1, 2, 3}, {4, 4, 5}, {7, 8, 6}}, "zerolast", Moves("")); verification.Error == "" {
+		t.Errorf("Verify accepted a board with a duplicate tile")
+	}
+}
+
+func TestCheckOptimal(t *testing.T) {
+	opt := Option{Algo: "ida", Heuristic: "astar_manhattan_conflict", Workers: 1, SeenNodesSplit: 1, RAMMaxGB: 1}
+	for _, disposition := range []string{"snail", "zerolast"} {
+		board := GridGenerator(3, disposition)
+		opt.StringInput, opt.Disposition = "3 "+MatrixToStringHashOnly(board, " "), disposition
+		outcome, _ := NewSolver(opt).Solve(context.Background())
+		if outcome.Status != StatusOK {
+			t.Fatalf("Solve of %v returned %v", board, outcome)
+		}
+		detour := Moves("UD")
+		if Verify(Goal(3, disposition), disposition, detour).Played != 2 {
+			detour = Moves("DU")
+		}
+		for _, moves := range []Moves{outcome.Moves, append(append(Moves{}, outcome.Moves...), detour...)} {
+			verification := Verify(board, disposition, moves)
+			if err := verification.CheckOptimal(context.Background(), board, disposition, opt); err != nil {
+				t.Fatal(err)
+			}
+			if optimal := len(moves) == len(outcome.Moves); !verification.Solved || verification.Optimal != optimal {
+				t.Errorf("Verify(%v, %s, %s) = %+v, optimal should be %v", board, disposition, moves, verification, optimal)
+			}
+		}
+	}
+}
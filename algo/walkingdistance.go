@@ -0,0 +1,128 @@
+package algo
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Walking distance only looks at which goal line each tile belongs to. A
+// table key holds, for every line of the board, how many tiles of each goal
+// line it contains, followed by the line of the empty tile
+type walkingDistance struct {
+	Size     int
+	GoalRow  []int
+	GoalCol  []int
+	RowTable map[string]byte
+	ColTable map[string]byte
+}
+
+var walkingDistanceCache = struct {
+	sync.Mutex
+	tables map[string]*walkingDistance
+}{tables: map[string]*walkingDistance{}}
+
+// Breadth first search from the goal : moving the empty tile to the next line
+// swaps it with any tile of that line, whatever its column
+func buildWalkingTable(goal [][]int, goalLine []int, lineOf func(i, j int) int) map[string]byte {
+	size := len(goal)
+	start := make([]byte, size*size+1)
+	for i, row := range goal {
+		for j, value := range row {
+			if value == 0 {
+				start[size*size] = byte(lineOf(i, j))
+			} else {
+				start[lineOf(i, j)*size+goalLine[value]]++
+			}
+		}
+	}
+	table := map[string]byte{string(start): 0}
+	current := []string{string(start)}
+	for cost := 1; len(current) > 0; cost++ {
+		next := []string{}
+		for _, key := range current {
+			counts := []byte(key)
+			blank := int(counts[size*size])
+			for _, line := range []int{blank - 1, blank + 1} {
+				if line < 0 || line >= size {
+					continue
+				}
+				for group := 0; group < size; group++ {
+					if counts[line*size+group] == 0 {
+						continue
+					}
+					counts[line*size+group]--
+					counts[blank*size+group]++
+					counts[size*size] = byte(line)
+					if _, ok := table[string(counts)]; !ok {
+						table[string(counts)] = byte(cost)
+						next = append(next, string(counts))
+					}
+					counts[line*size+group]++
+					counts[blank*size+group]--
+					counts[size*size] = byte(blank)
+				}
+			}
+		}
+		current = next
+	}
+	return table
+}
+
+func getWalkingDistance(size int, disposition string, logger Logger) *walkingDistance {
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	key := fmt.Sprintf("%d_%s", size, disposition)
+	walkingDistanceCache.Lock()
+	defer walkingDistanceCache.Unlock()
+	if wd, ok := walkingDistanceCache.tables[key]; ok {
+		return wd
+	}
+	goal := Goal(size, disposition)
+	wd := &walkingDistance{Size: size, GoalRow: make([]int, size*size), GoalCol: make([]int, size*size)}
+	for i, row := range goal {
+		for j, value := range row {
+			wd.GoalRow[value] = i
+			wd.GoalCol[value] = j
+		}
+	}
+	wd.RowTable = buildWalkingTable(goal, wd.GoalRow, func(i, j int) int { return i })
+	wd.ColTable = buildWalkingTable(goal, wd.GoalCol, func(i, j int) int { return j })
+	logger.Printf("Walking distance tables built with %d row and %d column entries\n", len(wd.RowTable), len(wd.ColTable))
+	walkingDistanceCache.tables[key] = wd
+	return wd
+}
+
+func (wd *walkingDistance) Heuristic(tiles []byte) int {
+	size := wd.Size
+	var rowKey, colKey [MaxMapSize*MaxMapSize + 1]byte
+	for cell, tile := range tiles {
+		if tile == 0 {
+			rowKey[size*size] = byte(cell / size)
+			colKey[size*size] = byte(cell % size)
+			continue
+		}
+		rowKey[cell/size*size+wd.GoalRow[tile]]++
+		colKey[cell%size*size+wd.GoalCol[tile]]++
+	}
+	return int(wd.RowTable[string(rowKey[:size*size+1])]) + int(wd.ColTable[string(colKey[:size*size+1])])
+}
+
+func walkingDistanceGenerator(greedy bool) func(param *AlgoParameters) (Eval, error) {
+	return func(param *AlgoParameters) (eval Eval, err error) {
+		if len(param.Board) > 4 {
+			return eval, fmt.Errorf("Walking distance tables are limited to boards up to 4x4")
+		}
+		wd := getWalkingDistance(len(param.Board), param.Disposition, param.logger())
+		eval.Fx = func(pos, startPos, goalPos [][]int, path []byte) int {
+			if greedy {
+				return wd.Heuristic([]byte(BoardToState(pos)))
+			}
+			return len(path) + 1 + wd.Heuristic([]byte(BoardToState(pos)))
+		}
+		eval.Tiles = tileEvalGenerator(1, greedy, Heuristic{Full: func(tiles []byte, goal *GoalTable) int {
+			return wd.Heuristic(tiles)
+		}})
+		return eval, nil
+	}
+}
@@ -0,0 +1,31 @@
+package algo
+
+// Zobrist hashing : a board hashes to the xor of one random key per
+// (cell, tile) pair, so a move updates the hash with four xors
+var zobristKeys = func() (keys [MaxMapSize * MaxMapSize][MaxMapSize * MaxMapSize]uint64) {
+	seed := uint64(0x9e3779b97f4a7c15)
+	for cell := range keys {
+		for tile := range keys[cell] {
+			// splitmix64
+			seed += 0x9e3779b97f4a7c15
+			z := seed
+			z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+			z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+			keys[cell][tile] = z ^ (z >> 31)
+		}
+	}
+	return
+}()
+
+func zobristHash(tiles []byte) (hash uint64) {
+	for cell, tile := range tiles {
+		hash ^= zobristKeys[cell][tile]
+	}
+	return hash
+}
+
+// Hash after tile moved from cell `from` to cell `to`, the empty tile going
+// the other way
+func zobristUpdate(hash uint64, tile byte, from, to int) uint64 {
+	return hash ^ zobristKeys[from][tile] ^ zobristKeys[to][tile] ^ zobristKeys[to][0] ^ zobristKeys[from][0]
+}
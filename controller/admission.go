@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Memory of a solve besides its states : boards, paths, goroutines
+	solveBaseMemory = 64 << 20
+	// Pattern databases and walking distance tables, while being built
+	tablesMemory = 128 << 20
+	// Every state of the 8-puzzle, stored by a best-first search
+	smallBoardMemory = 128 << 20
+)
+
+// Time a synchronous solve may wait for memory before being refused
+const admissionWait = 10 * time.Second
+
+// Free memory is checked again at least this often while solves wait
+const admissionPoll = 500 * time.Millisecond
+
+var errNotEnoughMemory = errors.New("Not enough memory available for this solve")
+
+// Memory reserved for a solve. IDA* stores its path and the tables of its
+// heuristic only. Best-first searches store the states they reach : all the
+// states of the 8-puzzle, or up to the RAM given to the solver on larger
+// boards
+func estimateMemory(opt *algo.Option, size int) (need uint64) {
+	need = solveBaseMemory
+	if opt.Heuristic == "astar_pdb" || opt.Heuristic == "astar_walking_distance" || opt.Heuristic == "greedy_walking_distance" {
+		need += tablesMemory
+	}
+	need += uint64(opt.TTShare * float64(opt.RAMMaxGB<<30))
+	if opt.Algo != "ida" && size <= 3 {
+		need += smallBoardMemory
+	} else if opt.Algo != "ida" {
+		need += opt.RAMMaxGB << 30
+	}
+	return need
+}
+
+type admittedSolve struct {
+	Algo     string    `json:"algo"`
+	Size     int       `json:"size"`
+	Reserved uint64    `json:"reserved"`
+	Since    time.Time `json:"since"`
+}
+
+// Admits solves while the memory they need is free. Free memory is the
+// budget left by the admitted solves, bounded by the RAM available
+// minus algo.MinRAMAvailableMB. A solve needing more than the whole budget
+// is admitted alone. Waiting solves are not ordered
+type AdmissionController struct {
+	Budget uint64
+
+	mu       sync.Mutex
+	reserved uint64
+	nextID   int
+	admitted map[int]admittedSolve
+	waiting  int
+	changed  chan struct{}
+}
+
+func NewAdmissionController(budget uint64) *AdmissionController {
+	return &AdmissionController{Budget: budget, admitted: map[int]admittedSolve{}, changed: make(chan struct{})}
+}
+
+// Budget used when none is configured : the RAM available at startup
+func DefaultAdmissionBudget() (uint64, error) {
+	available, err := algo.GetAvailableRAM()
+	if err != nil {
+		return 0, err
+	}
+	if reserve := algo.MinRAMAvailableMB << 20; available > reserve {
+		return available - reserve, nil
+	}
+	return 0, nil
+}
+
+// Free memory given the RAM available, read by the caller before locking the
+// controller
+func (admission *AdmissionController) free(available uint64, err error) uint64 {
+	free := uint64(0)
+	if admission.reserved < admission.Budget {
+		free = admission.Budget - admission.reserved
+	}
+	if reserve := algo.MinRAMAvailableMB << 20; err != nil || available < reserve {
+		return 0
+	} else if available-reserve < free {
+		free = available - reserve
+	}
+	return free
+}
+
+func (admission *AdmissionController) tryAdmit(solve admittedSolve) (id int, ok bool) {
+	available, err := algo.GetAvailableRAM()
+	admission.mu.Lock()
+	defer admission.mu.Unlock()
+	if len(admission.admitted) > 0 && solve.Reserved > admission.free(available, err) {
+		return 0, false
+	}
+	admission.nextID++
+	admission.reserved += solve.Reserved
+	admission.admitted[admission.nextID] = solve
+	return admission.nextID, true
+}
+
+func (admission *AdmissionController) release(id int) {
+	admission.mu.Lock()
+	defer admission.mu.Unlock()
+	admission.reserved -= admission.admitted[id].Reserved
+	delete(admission.admitted, id)
+	close(admission.changed)
+	admission.changed = make(chan struct{})
+}
+
+// Waits until the solve of opt is admitted, or fails once ctx is done. The
+// returned function gives the memory back
+func (admission *AdmissionController) acquire(ctx context.Context, opt *algo.Option, size int) (release func(), err error) {
+	solve := admittedSolve{Algo: opt.Algo, Size: size, Reserved: estimateMemory(opt, size), Since: time.Now()}
+	admission.mu.Lock()
+	admission.waiting++
+	admission.mu.Unlock()
+	defer func() {
+		admission.mu.Lock()
+		admission.waiting--
+		admission.mu.Unlock()
+	}()
+	ticker := time.NewTicker(admissionPoll)
+	defer ticker.Stop()
+	for {
+		admission.mu.Lock()
+		changed := admission.changed
+		admission.mu.Unlock()
+		if id, ok := admission.tryAdmit(solve); ok {
+			return func() { admission.release(id) }, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errNotEnoughMemory
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refusal of a solve that waited admissionWait for memory
+func rejectForMemory(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(admissionWait.Seconds())))
+	abortWithError(c, http.StatusServiceUnavailable, errNotEnoughMemory.Error())
+}
+
+func (admission *AdmissionController) Status(c *gin.Context) {
+	available, err := algo.GetAvailableRAM()
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	admission.mu.Lock()
+	defer admission.mu.Unlock()
+	solves := make([]admittedSolve, 0, len(admission.admitted))
+	for _, solve := range admission.admitted {
+		solves = append(solves, solve)
+	}
+	sort.Slice(solves, func(i, j int) bool { return solves[i].Since.Before(solves[j].Since) })
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"budget":    admission.Budget,
+		"reserved":  admission.reserved,
+		"free":      admission.free(available, nil),
+		"available": available,
+		"waiting":   admission.waiting,
+		"solves":    solves,
+	})
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/models"
+)
+
+// Solutions read per batch by the audit
+const auditBatch = 100
+
+// Problems of a stored solution : a board that can not be read, a path that
+// does not solve it or whose length is not the stored one. With a solver,
+// solutions stored as optimal are solved again when the lower bound does not
+// prove them optimal
+func auditSolution(ctx context.Context, solution *models.Solution, solver *algo.Option) (problems []string) {
+	board, err := boardFromHash(solution.Hash, solution.Size)
+	if err != nil {
+		return []string{"Invalid board : " + err.Error()}
+	}
+	verification := algo.Verify(board, solution.Disposition, algo.Moves(solution.Path))
+	if !verification.Solved {
+		problems = append(problems, verification.Error)
+	}
+	if solution.Length != len(solution.Path) {
+		problems = append(problems, fmt.Sprintf("Length %d for a path of %d moves", solution.Length, len(solution.Path)))
+	}
+	if solver == nil || solution.Bound != 1 || !verification.Solved {
+		return problems
+	}
+	if err := verification.CheckOptimal(ctx, board, solution.Disposition, *solver); err != nil {
+		problems = append(problems, "Optimality unknown : "+err.Error())
+	} else if !verification.Optimal {
+		problems = append(problems, fmt.Sprintf("Not optimal : %d moves instead of %d", verification.Length, verification.OptimalLength))
+	}
+	return problems
+}
+
+// Replays the path of every stored solution against its board, and reports
+// the problems of the corrupt ones. Optimal solutions are solved again with
+// solver when it is not nil
+func AuditSolutions(ctx context.Context, store models.SolutionStore, solver *algo.Option, report func(solution *models.Solution, problems []string)) (audited int, corrupt int, err error) {
+	err = store.List(auditBatch, func(solution *models.Solution) error {
+		audited++
+		if problems := auditSolution(ctx, solution, solver); len(problems) > 0 {
+			corrupt++
+			report(solution, problems)
+		}
+		return ctx.Err()
+	})
+	return audited, corrupt, err
+}
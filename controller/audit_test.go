@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/models"
+)
+
+func TestAuditSolutions(t *testing.T) {
+	_, store := newTestRouter(t)
+	for _, solution := range []models.Solution{
+		{Hash: "1.2.3.0.4.5.7.8.6.", Path: "RRD", Length: 3},
+		{Hash: "1.2.3.4.5.6.0.7.8.", Path: "RRUD", Length: 4},
+		{Hash: "1.2.3.4.5.0.7.8.6.", Path: "DUD", Length: 3, Bound: 2},
+		{Hash: "1.2.3.4.0.6.7.5.8.", Path: "D", Length: 1},
+		{Hash: "1.2.3.4.5.6.7.0.8.", Path: "LRRR", Length: 4},
+		{Hash: "1.2.0.4.5.3.7.8.6.", Path: "DD", Length: 1},
+		{Hash: "1.2.3.0.4.5.7.8.", Path: "RRD", Length: 3},
+	} {
+		solution.Size, solution.Disposition = 3, "zerolast"
+		if err := store.Save(&solution); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reported []uint
+	report := func(solution *models.Solution, problems []string) {
+		reported = append(reported, solution.ID)
+	}
+	if audited, corrupt, err := AuditSolutions(context.Background(), store, nil, report); audited != 7 || corrupt != 4 || err != nil {
+		t.Errorf("AuditSolutions() = %d, %d, %v, reporting %v", audited, corrupt, err, reported)
+	}
+
+	reported = nil
+	solver := &algo.Option{}
+	algo.InitOptionForApiUse(solver, "IDA")
+	solver.Debug = false
+	if audited, corrupt, err := AuditSolutions(context.Background(), store, solver, report); audited != 7 || corrupt != 5 || err != nil || reported[0] != 2 {
+		t.Errorf("AuditSolutions() = %d, %d, %v, reporting %v with a solver", audited, corrupt, err, reported)
+	}
+}
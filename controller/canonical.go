@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/models"
+)
+
+// Solutions are stored under the representative of the symmetric images of
+// their board, see algo.Canonicalize, with the moves of the representative.
+// A solution then serves every image of its board
+
+// Rewrites the solution of board to the one of its representative
+func canonicalizeSolution(solution *models.Solution, board [][]int) {
+	canonical, symmetry := algo.Canonicalize(board, solution.Disposition)
+	solution.Hash = algo.MatrixToStringHashOnly(canonical, ".")
+	solution.Path = symmetry.Moves(algo.Moves(solution.Path)).String()
+}
+
+// Stored solution of the board described by stringInput, its path
+// translated back from the representative of the board. Solutions stored
+// before the representatives are still found under the board itself. On a
+// miss, the end of a stored path going through the board is served
+func GetSolutionByStringInput(solution *models.Solution, store models.SolutionStore, stringInput string, disposition string) error {
+	scanner := bufio.NewScanner(strings.NewReader(stringInput))
+	board, err := algo.ParseInput(scanner)
+	if err != nil {
+		return err
+	}
+	canonical, symmetry := algo.Canonicalize(board, disposition)
+	hash := algo.MatrixToStringHashOnly(canonical, ".")
+	if err := store.GetByHash(solution, hash, disposition); err == nil {
+		solution.Hash = algo.MatrixToStringHashOnly(board, ".")
+		solution.Path = symmetry.Inverse().Moves(algo.Moves(solution.Path)).String()
+		return nil
+	}
+	if symmetry != algo.Identity {
+		if err := store.GetByHash(solution, algo.MatrixToStringHashOnly(board, "."), disposition); err == nil {
+			return nil
+		}
+	}
+	*solution = models.Solution{}
+	if err := getSolutionFromStates(solution, store, hash, disposition, symmetry); err != nil {
+		return err
+	}
+	solution.Hash = algo.MatrixToStringHashOnly(board, ".")
+	return nil
+}
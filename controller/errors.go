@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Body of every error response of the API, as described by the ErrorResponse
+// schema of /openapi.json
+type ErrorResponse struct {
+	Status string `json:"status"`
+	Msg    string `json:"msg,omitempty"`
+}
+
+var errorStatuses = map[int]string{
+	http.StatusBadRequest:          "INVALID",
+	http.StatusNotFound:            "NOTFOUND",
+	http.StatusConflict:            "CONFLICT",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusInternalServerError: "ERROR",
+}
+
+// Writes the error response and stops the handlers of the request
+func abortWithError(c *gin.Context, code int, msg string) {
+	status, ok := errorStatuses[code]
+	if !ok {
+		status = errorStatuses[http.StatusInternalServerError]
+	}
+	c.IndentedJSON(code, ErrorResponse{Status: status, Msg: msg})
+	c.Abort()
+}
+
+func abortWithBadRequest(c *gin.Context, err error) {
+	abortWithError(c, http.StatusBadRequest, "Wrong Format : "+err.Error())
+}
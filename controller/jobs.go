@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Idle workers look for queued jobs at least this often
+const jobPollInterval = time.Second
+
+// Solvers of the jobs, by the name used in the requests
+var jobAlgos = map[string]string{"ida": "IDA", "astar": "A*", "bidir": "MM"}
+
+type JobRequest struct {
+	SolveRequest
+	Algo string `json:"algo"`
+}
+
+type JobResponse struct {
+	ID          uint           `json:"id"`
+	Status      string         `json:"status"`
+	Algo        string         `json:"algo"`
+	Size        int            `json:"size"`
+	Board       string         `json:"board"`
+	Disposition string         `json:"disposition"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	Result      *SolveResponse `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+func newJobResponse(job *models.Job) JobResponse {
+	response := JobResponse{ID: job.ID, Status: job.Status, Algo: job.Algo, Size: job.Size, Board: job.Board, Disposition: job.Disposition, CreatedAt: job.CreatedAt, UpdatedAt: job.UpdatedAt, Error: job.Error}
+	if job.Result != "" {
+		response.Result = &SolveResponse{}
+		if err := json.Unmarshal([]byte(job.Result), response.Result); err != nil {
+			fmt.Fprintf(os.Stderr, "Corrupted result for job %d : %s\n", job.ID, err.Error())
+			response.Result = nil
+		}
+	}
+	return response
+}
+
+// Jobs are queued in the DB and solved by a bounded pool of workers. Jobs
+// still running when the process stopped are queued again on Start. A job
+// identical to a running solve waits for its response. Otherwise it waits
+// for its admission, then its progress is streamed under its ID. Solutions
+// are read from and saved to Store
+type JobQueue struct {
+	DB        *gorm.DB
+	Store     models.SolutionStore
+	Registry  *JobRegistry
+	Admission *AdmissionController
+	Progress  *ProgressHub
+	Workers   int
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+	wake    chan struct{}
+}
+
+func NewJobQueue(db *gorm.DB, store models.SolutionStore, registry *JobRegistry, admission *AdmissionController, progress *ProgressHub, workers int) *JobQueue {
+	return &JobQueue{DB: db, Store: store, Registry: registry, Admission: admission, Progress: progress, Workers: workers, running: map[uint]context.CancelFunc{}, wake: make(chan struct{}, workers)}
+}
+
+func (queue *JobQueue) Start() error {
+	count, err := models.RequeueRunningJobs(queue.DB)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		fmt.Printf("Requeued %d jobs interrupted by the last shutdown\n", count)
+	}
+	for i := 0; i < queue.Workers; i++ {
+		go queue.work()
+	}
+	return nil
+}
+
+func (queue *JobQueue) work() {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		job, ctx, ok := queue.claim()
+		if !ok {
+			select {
+			case <-queue.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+		queue.run(ctx, job)
+	}
+}
+
+// Oldest queued job, now marked as running
+func (queue *JobQueue) claim() (job *models.Job, ctx context.Context, ok bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	job = &models.Job{}
+	if err := job.GetFirstJobByStatus(queue.DB, models.JobQueued); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Fprintln(os.Stderr, "Failure reading the job queue :", err.Error())
+		}
+		return nil, nil, false
+	}
+	job.Status = models.JobRunning
+	if err := job.UpdateJob(queue.DB); err != nil {
+		fmt.Fprintln(os.Stderr, "Failure starting job :", err.Error())
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.running[job.ID] = cancel
+	return job, ctx, true
+}
+
+func (queue *JobQueue) run(ctx context.Context, job *models.Job) {
+	request := SolveRequest{Size: job.Size, Board: job.Board, PreviousCompute: job.PreviousCompute, Disposition: job.Disposition, QuickSolve: job.QuickSolve, TimeoutMs: job.TimeoutMs}
+	opt := newApiOption(job.Algo, request)
+	solution := &models.Solution{}
+	var response SolveResponse
+	if err := GetSolutionByStringInput(solution, queue.Store, opt.StringInput, job.Disposition); err == nil && job.PreviousCompute {
+		outcome := algo.SolveOutcome{Status: algo.StatusOK, Moves: algo.Moves(solution.Path), Duration: time.Duration(solution.ComputeMs * 1000), Algorithm: solution.Algo, Bound: solution.Bound}
+		response = SolveResponse{SolveOutcome: outcome, Solution: solution.Path, Time: outcome.Duration.String(), Algo: solution.Algo, Workers: solution.Workers}
+	} else {
+		response = queue.solve(ctx, job, opt)
+	}
+	queue.mu.Lock()
+	queue.running[job.ID]()
+	delete(queue.running, job.ID)
+	queue.mu.Unlock()
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failure encoding job result :", err.Error())
+	}
+	job.Result = string(content)
+	switch response.Status {
+	case algo.StatusOK:
+		job.Status = models.JobDone
+	case algo.StatusCancelled:
+		job.Status = models.JobCancelled
+	default:
+		job.Status, job.Error = models.JobFailed, response.Error
+	}
+	if err := job.UpdateJob(queue.DB); err != nil {
+		fmt.Fprintf(os.Stderr, "Failure saving the result of job %d : %s\n", job.ID, err.Error())
+	}
+}
+
+func (queue *JobQueue) solve(ctx context.Context, job *models.Job, opt *algo.Option) SolveResponse {
+	key, running, err := newRunningSolve(opt)
+	if err != nil {
+		outcome := algo.SolveOutcome{Status: algo.StatusInvalidParam, Error: err.Error()}
+		return SolveResponse{SolveOutcome: outcome, Algo: job.Algo}
+	}
+	running.ProgressID = jobProgressID(job.ID)
+	flight, _, err := queue.Registry.solve(ctx, queue.Admission, queue.Progress, opt, key, running, func(ctx context.Context) SolveResponse {
+		return runSolve(ctx, queue.Store, job.Algo, opt, queue.Progress, running.ProgressID)
+	})
+	var response SolveResponse
+	ok := err == nil
+	if ok {
+		response, ok = queue.Registry.wait(ctx, flight)
+	}
+	if !ok {
+		if err == nil {
+			err = ctx.Err()
+		}
+		outcome := algo.SolveOutcome{Status: algo.StatusCancelled, Error: err.Error()}
+		return SolveResponse{SolveOutcome: outcome, Algo: job.Algo}
+	}
+	return response
+}
+
+// A queued job is cancelled at once, a running one once its solver stops
+func (queue *JobQueue) cancel(id uint) (job *models.Job, err error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	job = &models.Job{}
+	if err := job.GetJobById(queue.DB, id); err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case models.JobQueued:
+		job.Status = models.JobCancelled
+		err = job.UpdateJob(queue.DB)
+	case models.JobRunning:
+		if cancel, ok := queue.running[id]; ok {
+			cancel()
+		}
+	}
+	return job, err
+}
+
+func parseJobId(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		abortWithBadRequest(c, fmt.Errorf("job id %q is not a number", c.Param("id")))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (queue *JobQueue) Create(c *gin.Context) {
+	var newRequest JobRequest
+	if err := bindRequest(c, "JobRequest", &newRequest); err != nil {
+		abortWithBadRequest(c, err)
+		return
+	}
+	if err := newRequest.SolveRequest.validate(); err != nil {
+		abortWithBadRequest(c, err)
+		return
+	}
+	if newRequest.Algo == "" {
+		newRequest.Algo = "ida"
+	}
+	algoName, ok := jobAlgos[newRequest.Algo]
+	if !ok {
+		abortWithBadRequest(c, fmt.Errorf("algo %q is not one of ida, astar, bidir", newRequest.Algo))
+		return
+	}
+	job := &models.Job{Status: models.JobQueued, Algo: algoName, Size: newRequest.Size, Board: newRequest.Board, Disposition: newRequest.Disposition, PreviousCompute: newRequest.PreviousCompute, QuickSolve: newRequest.QuickSolve, TimeoutMs: newRequest.TimeoutMs}
+	if err := job.CreateJob(queue.DB); err != nil {
+		abortWithError(c, http.StatusInternalServerError, "Failure queueing job : "+err.Error())
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Queued job %d : %v\n", job.ID, newRequest)
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+	c.IndentedJSON(http.StatusAccepted, newJobResponse(job))
+}
+
+func (queue *JobQueue) Get(c *gin.Context) {
+	id, ok := parseJobId(c)
+	if !ok {
+		return
+	}
+	job := &models.Job{}
+	if err := job.GetJobById(queue.DB, id); err != nil {
+		abortWithError(c, http.StatusNotFound, fmt.Sprintf("No job with id %d", id))
+		return
+	}
+	c.IndentedJSON(http.StatusOK, newJobResponse(job))
+}
+
+func (queue *JobQueue) Cancel(c *gin.Context) {
+	id, ok := parseJobId(c)
+	if !ok {
+		return
+	}
+	job, err := queue.cancel(id)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		abortWithError(c, http.StatusNotFound, fmt.Sprintf("No job with id %d", id))
+	case err != nil:
+		abortWithError(c, http.StatusInternalServerError, "Failure cancelling job : "+err.Error())
+	case job.Status == models.JobRunning:
+		c.IndentedJSON(http.StatusAccepted, newJobResponse(job))
+	case job.Status == models.JobCancelled && job.Result == "":
+		c.IndentedJSON(http.StatusOK, newJobResponse(job))
+	default:
+		abortWithError(c, http.StatusConflict, "Job already over : "+job.Status)
+	}
+}
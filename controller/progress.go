@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/gin-gonic/gin"
+)
+
+// Time between two progress events of a running solve
+const progressInterval = 500 * time.Millisecond
+
+// Snapshots kept for a subscriber not reading fast enough. Older ones are
+// dropped : only the latest progress matters
+const progressBuffer = 16
+
+var errProgressIDInUse = errors.New("Solve id already in use")
+
+// Progress ids are prefixed with the origin of the solve, so that the id
+// chosen by a client never names a job
+func requestProgressID(id string) string {
+	return "req-" + id
+}
+
+func jobProgressID(id uint) string {
+	return "job-" + strconv.FormatUint(uint64(id), 10)
+}
+
+// Progress of the running solves, by id, shared by the repositories. Every
+// subscriber of an id receives its snapshots until the solve is over
+type ProgressHub struct {
+	mu     sync.Mutex
+	solves map[string]map[chan algo.Progress]bool
+}
+
+func NewProgressHub() *ProgressHub {
+	return &ProgressHub{solves: map[string]map[chan algo.Progress]bool{}}
+}
+
+func (hub *ProgressHub) start(id string) error {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, ok := hub.solves[id]; ok {
+		return errProgressIDInUse
+	}
+	hub.solves[id] = map[chan algo.Progress]bool{}
+	return nil
+}
+
+func (hub *ProgressHub) publish(id string, progress algo.Progress) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for subscriber := range hub.solves[id] {
+		select {
+		case subscriber <- progress:
+		default:
+		}
+	}
+}
+
+// Closes the channels of the subscribers, after the last snapshot
+func (hub *ProgressHub) finish(id string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for subscriber := range hub.solves[id] {
+		close(subscriber)
+	}
+	delete(hub.solves, id)
+}
+
+func (hub *ProgressHub) subscribe(id string) (subscriber chan algo.Progress, ok bool) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	subscribers, ok := hub.solves[id]
+	if !ok {
+		return nil, false
+	}
+	subscriber = make(chan algo.Progress, progressBuffer)
+	subscribers[subscriber] = true
+	return subscriber, true
+}
+
+func (hub *ProgressHub) unsubscribe(id string, subscriber chan algo.Progress) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if subscribers, ok := hub.solves[id]; ok && subscribers[subscriber] {
+		delete(subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// Streams the progress of the solve with this id, req-<id of the request>
+// or job-<id of the job>, as Server-Sent Events : "progress" events, then an "end" event once the solve is over
+func (repo *Repository) StreamProgress(c *gin.Context) {
+	id := c.Param("id")
+	subscriber, ok := repo.Progress.subscribe(id)
+	if !ok {
+		abortWithError(c, http.StatusNotFound, "No solve in progress with id "+id)
+		return
+	}
+	defer repo.Progress.unsubscribe(id, subscriber)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case progress, ok := <-subscriber:
+			if !ok {
+				c.SSEvent("end", gin.H{"id": id})
+				return false
+			}
+			c.SSEvent("progress", progress)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/gin-gonic/gin"
+)
+
+// Solve in flight, waiting for its admission or running, as listed by
+// GET /jobs. Clients counts the requests and jobs waiting for its response
+type RunningSolve struct {
+	Board       string    `json:"board"`
+	Size        int       `json:"size"`
+	Disposition string    `json:"disposition"`
+	Algo        string    `json:"algo"`
+	TimeoutMs   int64     `json:"timeoutMs,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	Clients     int       `json:"clients"`
+	ProgressID  string    `json:"progressId,omitempty"`
+}
+
+type solveFlight struct {
+	RunningSolve
+	key    string
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Closed once the solve is admitted and running, or abandoned
+	started   chan struct{}
+	abandoned bool
+	done      chan struct{}
+	response  SolveResponse
+}
+
+// Solves in flight, shared by the repositories and the job queue. A request
+// identical to a solve waiting for its admission or running attaches to it
+// and receives the same response. A solve is cancelled once none of its
+// clients is waiting
+type JobRegistry struct {
+	mu      sync.Mutex
+	flights map[string]*solveFlight
+}
+
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{flights: map[string]*solveFlight{}}
+}
+
+// Requests for the same board, disposition, solver and timeout are
+// identical, whatever the spacing of the board
+func newRunningSolve(opt *algo.Option) (key string, solve RunningSolve, err error) {
+	board, err := algo.ParseInput(bufio.NewScanner(strings.NewReader(opt.StringInput)))
+	if err != nil {
+		return "", solve, err
+	}
+	solve = RunningSolve{Board: algo.MatrixToStringHashOnly(board, "."), Size: len(board), Disposition: opt.Disposition, Algo: opt.Algo, TimeoutMs: opt.Timeout.Milliseconds()}
+	return strings.Join([]string{solve.Board, solve.Disposition, solve.Algo, strconv.FormatInt(solve.TimeoutMs, 10)}, "/"), solve, nil
+}
+
+// Attaches the caller to the solve with this key, or registers a new one not
+// yet started
+func (registry *JobRegistry) enter(key string, solve RunningSolve) (flight *solveFlight, created bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if flight, ok := registry.flights[key]; ok {
+		flight.Clients++
+		return flight, false
+	}
+	solve.StartedAt, solve.Clients = time.Now(), 1
+	flight = &solveFlight{RunningSolve: solve, key: key, started: make(chan struct{}), done: make(chan struct{})}
+	flight.ctx, flight.cancel = context.WithCancel(context.Background())
+	registry.flights[key] = flight
+	return flight, true
+}
+
+// Removes a solve that will not start. The clients attached to it enter the
+// registry again
+func (registry *JobRegistry) abandon(flight *solveFlight) {
+	registry.mu.Lock()
+	flight.abandoned = true
+	if registry.flights[flight.key] == flight {
+		delete(registry.flights, flight.key)
+	}
+	registry.mu.Unlock()
+	flight.cancel()
+	close(flight.started)
+}
+
+// Detaches a client. The last client leaving cancels the solve
+func (registry *JobRegistry) leave(flight *solveFlight) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	flight.Clients--
+	if flight.Clients == 0 {
+		flight.cancel()
+		if registry.flights[flight.key] == flight {
+			delete(registry.flights, flight.key)
+		}
+	}
+}
+
+// Attaches the caller to the solve with this key, or starts the solve of
+// opt once admitted. Identical solves attach while it waits for its
+// admission, so that only one of them waits. The progress of a new solve is
+// published under running.ProgressID, when set, until it is over. Fails if
+// the progress id is in use or if ctx is done before the solve is admitted
+func (registry *JobRegistry) solve(ctx context.Context, admission *AdmissionController, hub *ProgressHub, opt *algo.Option, key string, running RunningSolve, solveFx func(ctx context.Context) SolveResponse) (flight *solveFlight, created bool, err error) {
+	for {
+		if flight, created = registry.enter(key, running); created {
+			break
+		}
+		select {
+		case <-flight.started:
+		case <-ctx.Done():
+			registry.leave(flight)
+			return nil, false, errNotEnoughMemory
+		}
+		registry.mu.Lock()
+		abandoned := flight.abandoned
+		registry.mu.Unlock()
+		if !abandoned {
+			return flight, false, nil
+		}
+	}
+	progressID := running.ProgressID
+	if progressID != "" {
+		if err := hub.start(progressID); err != nil {
+			registry.abandon(flight)
+			return nil, false, err
+		}
+	}
+	release, err := admission.acquire(ctx, opt, running.Size)
+	if err != nil {
+		hub.finish(progressID)
+		registry.abandon(flight)
+		return nil, false, err
+	}
+	close(flight.started)
+	go registry.run(flight, func(ctx context.Context) SolveResponse {
+		defer release()
+		defer hub.finish(progressID)
+		return solveFx(ctx)
+	})
+	return flight, true, nil
+}
+
+func (registry *JobRegistry) run(flight *solveFlight, solveFx func(ctx context.Context) SolveResponse) {
+	response := solveFx(flight.ctx)
+	registry.mu.Lock()
+	flight.response = response
+	if registry.flights[flight.key] == flight {
+		delete(registry.flights, flight.key)
+	}
+	registry.mu.Unlock()
+	flight.cancel()
+	close(flight.done)
+}
+
+// Response of the solve, or false if ctx is done first : the caller then
+// leaves the solve. The last client leaving cancels it, and the next
+// identical request starts a new one
+func (registry *JobRegistry) wait(ctx context.Context, flight *solveFlight) (response SolveResponse, ok bool) {
+	select {
+	case <-flight.done:
+		return flight.response, true
+	case <-ctx.Done():
+	}
+	registry.leave(flight)
+	return SolveResponse{}, false
+}
+
+func (registry *JobRegistry) List(c *gin.Context) {
+	registry.mu.Lock()
+	solves := make([]RunningSolve, 0, len(registry.flights))
+	for _, flight := range registry.flights {
+		solves = append(solves, flight.RunningSolve)
+	}
+	registry.mu.Unlock()
+	sort.Slice(solves, func(i, j int) bool { return solves[i].StartedAt.Before(solves[j].StartedAt) })
+	c.IndentedJSON(http.StatusOK, solves)
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/fleblay/42-npuzzle/models"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Serves the OpenAPI 3 description of the routes below
+func OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPIDocument)
+}
+
+// Routes of the API. Each one is described by /openapi.json
+func Routes(router gin.IRoutes, store models.SolutionStore, registry *JobRegistry, admission *AdmissionController, progress *ProgressHub, jobs *JobQueue) {
+	repoASTAR := &Repository{Store: store, Algo: "A*", Registry: registry, Admission: admission, Progress: progress}
+	repoIDA := &Repository{Store: store, Algo: "IDA", Registry: registry, Admission: admission, Progress: progress}
+	repoMM := &Repository{Store: store, Algo: "MM", Registry: registry, Admission: admission, Progress: progress}
+
+	router.GET("/openapi.json", OpenAPI)
+	router.POST("/solve/ida", repoIDA.Solve)
+	router.POST("/solve/astar", repoASTAR.Solve)
+	router.POST("/solve/bidir", repoMM.Solve)
+	router.GET("/solve/:id/progress", repoIDA.StreamProgress)
+	router.GET("/jobs", registry.List)
+	router.GET("/status", admission.Status)
+	router.POST("/jobs", jobs.Create)
+	router.GET("/jobs/:id", jobs.Get)
+	router.DELETE("/jobs/:id", jobs.Cancel)
+	router.POST("/solution", repoIDA.GetSolution)
+	router.POST("/verify", repoIDA.Verify)
+	router.GET("/generate/:size/:disposition", repoIDA.Generate)
+	router.GET("/pick/:size", repoIDA.GetRandomFromDB)
+}
@@ -0,0 +1,496 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/database"
+	"github.com/fleblay/42-npuzzle/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Router of the API on an empty DB. The workers of the job queue are not
+// started : jobs stay queued
+func newTestRouter(t *testing.T) (*gin.Engine, models.SolutionStore) {
+	t.Helper()
+	db := newTestDB(t)
+	store := database.NewSQLiteStore(db)
+	return newTestRouterWithStore(db, store), store
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.ConnectDB(filepath.Join(t.TempDir(), "solutions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.CreateModel(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Router of the API keeping its jobs in db and its solutions in store
+func newTestRouterWithStore(db *gorm.DB, store models.SolutionStore) *gin.Engine {
+	progress, registry, admission := NewProgressHub(), NewJobRegistry(), NewAdmissionController(1<<40)
+	jobs := NewJobQueue(db, store, registry, admission, progress, 1)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Routes(router, store, registry, admission, progress, jobs)
+	return router
+}
+
+func serve(router *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// Decodes the only JSON value of the body
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder, value any) {
+	t.Helper()
+	decoder := json.NewDecoder(bytes.NewReader(recorder.Body.Bytes()))
+	if err := decoder.Decode(value); err != nil {
+		t.Fatalf("Body %q is not JSON : %s", recorder.Body.String(), err)
+	}
+	if decoder.More() {
+		t.Fatalf("Body %q holds more than one response", recorder.Body.String())
+	}
+}
+
+func expectError(t *testing.T, recorder *httptest.ResponseRecorder, code int, status string) {
+	t.Helper()
+	if recorder.Code != code {
+		t.Fatalf("Got code %d instead of %d : %s", recorder.Code, code, recorder.Body.String())
+	}
+	var response ErrorResponse
+	decodeBody(t, recorder, &response)
+	if response.Status != status {
+		t.Errorf("Got error %+v instead of status %s", response, status)
+	}
+}
+
+type openAPISchema struct {
+	Minimum *int     `json:"minimum"`
+	Maximum *int     `json:"maximum"`
+	Enum    []string `json:"enum"`
+	AllOf   []struct {
+		Properties map[string]openAPISchema `json:"properties"`
+	} `json:"allOf"`
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	router, _ := newTestRouter(t)
+	recorder := serve(router, http.MethodGet, "/openapi.json", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json returned %d", recorder.Code)
+	}
+	var document struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	decodeBody(t, recorder, &document)
+	if !strings.HasPrefix(document.OpenAPI, "3.") {
+		t.Errorf("Document is OpenAPI %q instead of 3", document.OpenAPI)
+	}
+
+	param := regexp.MustCompile(`:(\w+)`)
+	for _, route := range router.Routes() {
+		path := param.ReplaceAllString(route.Path, "{$1}")
+		if _, ok := document.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("Route %s %s is not described", route.Method, path)
+		}
+	}
+
+	schemas := document.Components.Schemas
+	if size := schemas["Size"]; size.Minimum == nil || *size.Minimum != algo.MinMapSize || size.Maximum == nil || *size.Maximum != algo.MaxMapSize {
+		t.Errorf("Size schema does not match the sizes between %d and %d", algo.MinMapSize, algo.MaxMapSize)
+	}
+	for _, disposition := range schemas["Disposition"].Enum {
+		if algo.Goal(3, disposition) == nil {
+			t.Errorf("Disposition %s of the enum has no goal", disposition)
+		}
+	}
+	var names []string
+	for name := range jobAlgos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	jobRequest := schemas["JobRequest"]
+	if len(jobRequest.AllOf) != 2 || strings.Join(jobRequest.AllOf[1].Properties["algo"].Enum, ",") != strings.Join(names, ",") {
+		t.Errorf("JobRequest algo enum does not match %v", names)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	router, _ := newTestRouter(t)
+	for _, disposition := range schemas["Disposition"].Enum {
+		recorder := serve(router, http.MethodGet, "/generate/3/"+disposition, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Generating a %s board returned %d : %s", disposition, recorder.Code, recorder.Body.String())
+		}
+		var board struct {
+			Size  int    `json:"size"`
+			Board string `json:"board"`
+		}
+		decodeBody(t, recorder, &board)
+		if err := validateBoard(board.Size, board.Board); board.Size != 3 || err != nil {
+			t.Errorf("Generated an invalid board %+v : %v", board, err)
+		}
+	}
+	for _, path := range []string{"/generate/2/snail", "/generate/17/snail", "/generate/three/snail", "/generate/3/spiral"} {
+		expectError(t, serve(router, http.MethodGet, path, ""), http.StatusBadRequest, "INVALID")
+	}
+}
+
+func TestSolveValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+	invalid := []string{
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5"`,
+		`{"size":"3","board":"1 2 3 8 0 4 7 6 5","disposition":"snail"}`,
+		`{"size":2,"board":"1 2 3 0","disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6","disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5 9","disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 6","disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 9","disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 x 4 7 6 5","disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5","disposition":"spiral"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail","timeoutMs":-1}`,
+		`{"size":17,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail"}`,
+		`{"size":3.5,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail"}`,
+		`{"size":3,"board":123,"disposition":"snail"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail","quickSolve":"yes"}`,
+		`{"size":3,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail","timeoutMs":1.5}`,
+		`[{"size":3,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail"}]`,
+	}
+	for _, path := range []string{"/solve/ida", "/solve/astar", "/solve/bidir", "/solution", "/jobs"} {
+		for _, body := range invalid {
+			t.Run(path, func(t *testing.T) {
+				expectError(t, serve(router, http.MethodPost, path, body), http.StatusBadRequest, "INVALID")
+			})
+		}
+	}
+	body := `{"size":3,"board":"1 2 3 8 0 4 7 6 5","disposition":"snail","algo":"dfs"}`
+	expectError(t, serve(router, http.MethodPost, "/jobs", body), http.StatusBadRequest, "INVALID")
+}
+
+// Solves are stored and served by each kind of store
+func TestSolveThenLookUp(t *testing.T) {
+	db := newTestDB(t)
+	jsonl, err := database.OpenJSONLStore(filepath.Join(t.TempDir(), "solutions.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jsonl.Close()
+	for name, store := range map[string]models.SolutionStore{database.StoreSQLite: database.NewSQLiteStore(db), database.StoreMemory: database.NewMemoryStore(), database.StoreJSONL: jsonl} {
+		t.Run(name, func(t *testing.T) {
+			router := newTestRouterWithStore(db, store)
+			body := `{"size":3,"board":"1 2 3 0 8 4 7 6 5","disposition":"snail"}`
+			expectError(t, serve(router, http.MethodPost, "/solution", body), http.StatusNotFound, "NOTFOUND")
+			expectError(t, serve(router, http.MethodGet, "/pick/3", ""), http.StatusNotFound, "NOTFOUND")
+
+			recorder := serve(router, http.MethodPost, "/solve/astar", body)
+			var response SolveResponse
+			decodeBody(t, recorder, &response)
+			if recorder.Code != http.StatusOK || response.Status != algo.StatusOK || response.Solution != "R" {
+				t.Fatalf("Solve returned %d : %s", recorder.Code, recorder.Body.String())
+			}
+
+			recorder = serve(router, http.MethodPost, "/solution", body)
+			var stored struct {
+				Status   string `json:"status"`
+				Solution string `json:"solution"`
+			}
+			decodeBody(t, recorder, &stored)
+			if recorder.Code != http.StatusOK || stored.Status != "DB" || stored.Solution != "R" {
+				t.Errorf("Lookup returned %d : %s", recorder.Code, recorder.Body.String())
+			}
+			// The board is stored as its representative, its image by a symmetry
+			recorder = serve(router, http.MethodGet, "/pick/3", "")
+			var board struct {
+				Board string `json:"board"`
+			}
+			decodeBody(t, recorder, &board)
+			if recorder.Code != http.StatusOK || strings.Join(strings.Fields(board.Board), " ") != "1 0 3 8 2 4 7 6 5" {
+				t.Errorf("Pick returned %d : %s", recorder.Code, recorder.Body.String())
+			}
+			expectError(t, serve(router, http.MethodGet, "/pick/1", ""), http.StatusBadRequest, "INVALID")
+		})
+	}
+}
+
+// Solutions serve the symmetric images of their board, with the image of
+// their moves
+func TestLookUpSymmetricBoard(t *testing.T) {
+	router, _ := newTestRouter(t)
+	recorder := serve(router, http.MethodPost, "/solve/astar", `{"size":3,"board":"1 2 3 4 5 6 0 7 8","disposition":"zerolast"}`)
+	var response SolveResponse
+	decodeBody(t, recorder, &response)
+	if recorder.Code != http.StatusOK || response.Solution != "RR" {
+		t.Fatalf("Solve returned %d : %s", recorder.Code, recorder.Body.String())
+	}
+	test := []struct {
+		board    string
+		solution string
+	}{
+		{"1 2 3 4 5 6 0 7 8", "RR"},
+		{"1 2 0 4 5 3 7 8 6", "DD"},
+	}
+	for _, test := range test {
+		for _, path := range []string{"/solution", "/solve/ida"} {
+			body := `{"size":3,"board":"` + test.board + `","disposition":"zerolast","previousCompute":true}`
+			recorder := serve(router, http.MethodPost, path, body)
+			var stored struct {
+				Status   string `json:"status"`
+				Solution string `json:"solution"`
+			}
+			decodeBody(t, recorder, &stored)
+			if recorder.Code != http.StatusOK || stored.Status != "DB" || stored.Solution != test.solution {
+				t.Errorf("POST %s of %s returned %d : %s", path, test.board, recorder.Code, recorder.Body.String())
+			}
+		}
+	}
+}
+
+func TestJobErrors(t *testing.T) {
+	router, _ := newTestRouter(t)
+	expectError(t, serve(router, http.MethodGet, "/jobs/first", ""), http.StatusBadRequest, "INVALID")
+	expectError(t, serve(router, http.MethodGet, "/jobs/42", ""), http.StatusNotFound, "NOTFOUND")
+	expectError(t, serve(router, http.MethodDelete, "/jobs/42", ""), http.StatusNotFound, "NOTFOUND")
+	expectError(t, serve(router, http.MethodGet, "/solve/unknown/progress", ""), http.StatusNotFound, "NOTFOUND")
+
+	recorder := serve(router, http.MethodPost, "/jobs", `{"size":3,"board":"1 2 3 0 8 4 7 6 5","disposition":"snail"}`)
+	var job JobResponse
+	decodeBody(t, recorder, &job)
+	if recorder.Code != http.StatusAccepted || job.Status != "queued" || job.Algo != "IDA" {
+		t.Fatalf("Queueing returned %d : %s", recorder.Code, recorder.Body.String())
+	}
+	path := "/jobs/" + strconv.FormatUint(uint64(job.ID), 10)
+	for i := 0; i < 2; i++ {
+		if recorder := serve(router, http.MethodDelete, path, ""); recorder.Code != http.StatusOK {
+			t.Fatalf("Cancelling a queued job returned %d : %s", recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+// A progress id is only taken by the request starting a solve, and the ids
+// of requests never name a job
+func TestRunningSolveKey(t *testing.T) {
+	keys := map[string]string{}
+	for name, request := range map[string]SolveRequest{
+		"spaced":     {Size: 3, Board: "1 2 3  0 8 4 7 6 5", Disposition: "snail"},
+		"compact":    {Size: 3, Board: "1 2 3 0 8 4 7 6 5", Disposition: "snail"},
+		"timeout":    {Size: 3, Board: "1 2 3 0 8 4 7 6 5", Disposition: "snail", TimeoutMs: 100},
+		"zerolast":   {Size: 3, Board: "1 2 3 0 8 4 7 6 5", Disposition: "zerolast"},
+		"quickSolve": {Size: 3, Board: "1 2 3 0 8 4 7 6 5", Disposition: "snail", QuickSolve: true},
+	} {
+		key, _, err := newRunningSolve(newApiOption("IDA", request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+	if keys["spaced"] != keys["compact"] {
+		t.Errorf("Spacing changes the key : %s and %s", keys["spaced"], keys["compact"])
+	}
+	for _, name := range []string{"timeout", "zerolast", "quickSolve"} {
+		if keys[name] == keys["compact"] {
+			t.Errorf("Request %s has the key %s of a different request", name, keys[name])
+		}
+	}
+}
+
+func TestProgressIDs(t *testing.T) {
+	hub, registry, admission := NewProgressHub(), NewJobRegistry(), NewAdmissionController(1<<40)
+	opt := &algo.Option{}
+	algo.InitOptionForApiUse(opt, "IDA")
+	opt.StringInput = "3 1 2 3 0 8 4 7 6 5"
+	key, running, err := newRunningSolve(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	blocked := func(ctx context.Context) SolveResponse {
+		<-release
+		return SolveResponse{}
+	}
+	running.ProgressID = requestProgressID("3")
+	flight, created, err := registry.solve(context.Background(), admission, hub, opt, key, running, blocked)
+	if !created || err != nil {
+		t.Fatalf("First solve gave %v, %v", created, err)
+	}
+	running.ProgressID = requestProgressID("4")
+	if _, created, err := registry.solve(context.Background(), admission, hub, opt, key, running, blocked); created || err != nil {
+		t.Errorf("Identical solve gave %v, %v instead of attaching", created, err)
+	}
+	for id, started := range map[string]bool{requestProgressID("3"): true, requestProgressID("4"): false, jobProgressID(3): false} {
+		if subscriber, ok := hub.subscribe(id); ok != started {
+			t.Errorf("Progress of %s started : %v", id, ok)
+		} else if ok {
+			hub.unsubscribe(id, subscriber)
+		}
+	}
+	running.ProgressID = requestProgressID("3")
+	if _, _, err := registry.solve(context.Background(), admission, hub, opt, "other", running, blocked); err != errProgressIDInUse {
+		t.Errorf("Solve reusing a running progress id gave %v", err)
+	}
+	close(release)
+	registry.wait(context.Background(), flight)
+	if _, ok := hub.subscribe(requestProgressID("3")); ok {
+		t.Errorf("Progress still open once the solve is over")
+	}
+}
+
+// Identical solves waiting for their admission run once
+func TestRegistryAdmissionWait(t *testing.T) {
+	registry, admission := NewJobRegistry(), NewAdmissionController(1)
+	opt := &algo.Option{}
+	algo.InitOptionForApiUse(opt, "IDA")
+	opt.StringInput = "3 1 2 3 0 8 4 7 6 5"
+	key, running, err := newRunningSolve(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker, err := admission.acquire(context.Background(), opt, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var solves int32
+	solveFx := func(ctx context.Context) SolveResponse {
+		atomic.AddInt32(&solves, 1)
+		return SolveResponse{Solution: "LURD"}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flight, _, err := registry.solve(context.Background(), admission, NewProgressHub(), opt, key, running, solveFx)
+			if err != nil {
+				t.Errorf("Solve waiting for its admission gave %v", err)
+				return
+			}
+			if response, ok := registry.wait(context.Background(), flight); !ok || response.Solution != "LURD" {
+				t.Errorf("Solve waiting for its admission returned %+v, %v", response, ok)
+			}
+		}()
+	}
+	for clients := 0; clients != 2; {
+		time.Sleep(time.Millisecond)
+		registry.mu.Lock()
+		if flight, ok := registry.flights[key]; ok {
+			clients = flight.Clients
+		}
+		registry.mu.Unlock()
+	}
+	blocker()
+	wg.Wait()
+	if solves != 1 {
+		t.Errorf("Identical solves waiting for their admission ran %d times", solves)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	blocker, _ = admission.acquire(context.Background(), opt, 3)
+	defer blocker()
+	if _, _, err := registry.solve(ctx, admission, NewProgressHub(), opt, key, running, solveFx); err != errNotEnoughMemory {
+		t.Errorf("Solve never admitted gave %v", err)
+	}
+	if len(registry.flights) != 0 {
+		t.Errorf("Registry still holds %d solves once the only one was refused", len(registry.flights))
+	}
+}
+
+func TestStreamProgress(t *testing.T) {
+	db := newTestDB(t)
+	store := database.NewSQLiteStore(db)
+	progress, registry, admission := NewProgressHub(), NewJobRegistry(), NewAdmissionController(1<<40)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Routes(router, store, registry, admission, progress, NewJobQueue(db, store, registry, admission, progress, 1))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	if response, err := http.Get(server.URL + "/solve/req-1/progress"); err != nil || response.StatusCode != http.StatusNotFound {
+		t.Fatalf("Progress of an unknown solve gave %v, %v", response, err)
+	}
+	id := requestProgressID("1")
+	progress.start(id)
+	go func() {
+		// Waits for the subscriber before sending the snapshots
+		for {
+			progress.mu.Lock()
+			subscribed := len(progress.solves[id]) > 0
+			progress.mu.Unlock()
+			if subscribed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		progress.publish(id, algo.Progress{Nodes: 12, Bound: 20})
+		progress.publish(id, algo.Progress{Nodes: 40, Bound: 22, Done: true})
+		progress.finish(id)
+	}()
+	response, err := http.Get(server.URL + "/solve/" + id + "/progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Errorf("Progress stream has content type %s", contentType)
+	}
+	var events, data []string
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if event := strings.TrimPrefix(scanner.Text(), "event:"); event != scanner.Text() {
+			events = append(events, event)
+		} else if value := strings.TrimPrefix(scanner.Text(), "data:"); value != scanner.Text() {
+			data = append(data, value)
+		}
+	}
+	if strings.Join(events, ",") != "progress,progress,end" || len(data) != 3 {
+		t.Fatalf("Progress stream sent events %v with data %v", events, data)
+	}
+	var last algo.Progress
+	if err := json.Unmarshal([]byte(data[1]), &last); err != nil || last.Nodes != 40 || !last.Done {
+		t.Errorf("Last progress event is %s : %+v, %v", data[1], last, err)
+	}
+	if !strings.Contains(data[2], id) {
+		t.Errorf("End event %s does not name %s", data[2], id)
+	}
+}
+
+// Boards the registry can not key are rejected, never solved without an
+// admission
+func TestJobUnkeyedBoard(t *testing.T) {
+	db := newTestDB(t)
+	queue := NewJobQueue(db, database.NewSQLiteStore(db), NewJobRegistry(), NewAdmissionController(1<<40), NewProgressHub(), 1)
+	job := &models.Job{Algo: "IDA", Size: 3, Board: "1 2 3", Disposition: "snail"}
+	opt := newApiOption(job.Algo, SolveRequest{Size: job.Size, Board: job.Board, Disposition: job.Disposition})
+	if response := queue.solve(context.Background(), job, opt); response.Status != algo.StatusInvalidParam || response.Error == "" {
+		t.Errorf("Solve of an invalid board returned %+v", response)
+	}
+}
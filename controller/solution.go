@@ -1,9 +1,10 @@
 package controller
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"runtime/debug"
@@ -14,136 +15,174 @@ import (
 	"github.com/fleblay/42-npuzzle/algo"
 	"github.com/fleblay/42-npuzzle/models"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+// Time given to ARA* to improve its first solution on quick solves
+const quickSolveDeadline = 2 * time.Second
+
 type SolveRequest struct {
 	Size            int    `json:"size"`
 	Board           string `json:"board"`
 	PreviousCompute bool   `json:"previousCompute"`
 	Disposition     string `json:"disposition"`
 	QuickSolve      bool   `json:"quickSolve"`
+	TimeoutMs       int64  `json:"timeoutMs"`
+	ID              string `json:"id"`
 }
 
-type Repository struct {
-	DB   *gorm.DB
-	Algo string
-	Jobs *[]string
+// Solve outcome, with the keys of the previous responses kept for existing
+// clients
+type SolveResponse struct {
+	algo.SolveOutcome
+	Solution string `json:"solution"`
+	Time     string `json:"time"`
+	Algo     string `json:"algo"`
+	Workers  int    `json:"workers"`
 }
 
-func (repo *Repository) addStringInputToJobs(input string) (err error) {
-	if index := algo.Index(*repo.Jobs, input); index != -1 {
-		return errors.New("Grid already beeing processed")
-	} else {
-		*repo.Jobs = append(*repo.Jobs, input)
-		return nil
-	}
+// Registry, Admission and Progress are shared by the repositories, so that
+// identical solves run once whatever their route and memory is shared by
+// all solves. The solutions are read from and saved to Store
+type Repository struct {
+	Store     models.SolutionStore
+	Algo      string
+	Registry  *JobRegistry
+	Admission *AdmissionController
+	Progress  *ProgressHub
 }
 
-func (repo *Repository) removeStringInputFromJobs(input string) (err error) {
-	if index := algo.Index(*repo.Jobs, input); index == -1 {
-		return errors.New("Grid already removed from jobs")
-	} else {
-		*repo.Jobs = append((*repo.Jobs)[:index], ((*repo.Jobs)[index+1:])...)
-		return nil
-	}
+// Solver options of the API for a request to the solver of algoName
+func newApiOption(algoName string, request SolveRequest) *algo.Option {
+	opt := &algo.Option{}
+	algo.InitOptionForApiUse(opt, algoName)
+	opt.Disposition = request.Disposition
+	opt.Timeout = time.Duration(request.TimeoutMs) * time.Millisecond
+	if request.QuickSolve {
+		opt.Algo = "arastar"
+		opt.Deadline = quickSolveDeadline
+	}
+	opt.StringInput = strconv.Itoa(request.Size) + " " + request.Board
+	return opt
 }
 
-func GetSolutionByStringInput(solution *models.Solution, db *gorm.DB, stringInput string, disposition string) error {
-	scanner := bufio.NewScanner(strings.NewReader(stringInput))
-	board, err := algo.ParseInput(scanner)
-	if err != nil {
-		return err
+// Solves and saves the solution when it is optimal. The progress is
+// published under progressID when it is not empty
+func runSolve(ctx context.Context, store models.SolutionStore, algoName string, opt *algo.Option, hub *ProgressHub, progressID string) SolveResponse {
+	var options []algo.SolverOption
+	if opt.Debug {
+		options = append(options, algo.WithLogger(log.New(os.Stderr, "", 0)))
+	}
+	if progressID != "" {
+		options = append(options, algo.WithProgress(progressInterval, func(progress algo.Progress) {
+			hub.publish(progressID, progress)
+		}))
+	}
+	outcome, solution := algo.NewSolver(*opt, options...).Solve(ctx)
+	if outcome.Status == algo.StatusOK && outcome.Bound == 1 {
+		canonicalizeSolution(solution, outcome.Board)
+		if err := store.Save(solution); err != nil {
+			fmt.Fprintln(os.Stderr, "Failure to save new solution to DB")
+		} else if solution.Indexed {
+			fmt.Fprintln(os.Stderr, "Board already stored with a solution as short")
+		} else if err := indexSolution(store, solution); err != nil {
+			fmt.Fprintln(os.Stderr, "Failure to index new solution :", err.Error())
+		}
+	} else if outcome.Status == algo.StatusInvalidParam || outcome.Status == algo.StatusInvalidFlags {
+		fmt.Fprintln(os.Stderr, "Wrong parameters or flags for solver init")
+	}
+	response := SolveResponse{SolveOutcome: outcome, Solution: outcome.Moves.String(), Time: outcome.Duration.String(), Algo: outcome.Algorithm, Workers: opt.Workers}
+	if response.Algo == "" {
+		response.Algo = algoName
 	}
-	hash := algo.MatrixToStringHashOnly(board, ".")
-	return solution.GetSolutionByHash(db, hash, disposition)
+	return response
 }
 
 func (repo *Repository) Solve(c *gin.Context) {
-	debug.FreeOSMemory()
-	opt := &algo.Option{}
-	algo.InitOptionForApiUse(opt, repo.Algo)
 	solution := &models.Solution{}
 
 	var newRequest SolveRequest
-	if err := c.BindJSON(&newRequest); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Wrong Format : " + err.Error()})
+	if err := bindRequest(c, "SolveRequest", &newRequest); err != nil {
+		abortWithBadRequest(c, err)
 		return
 	}
-	opt.Disposition = newRequest.Disposition
-	if newRequest.QuickSolve {
-		opt.Heuristic = "astar_manhattan_conflict1.3"
+	if err := newRequest.validate(); err != nil {
+		abortWithBadRequest(c, err)
+		return
 	}
+	opt := newApiOption(repo.Algo, newRequest)
 	fmt.Fprintln(os.Stderr, "Received request :", newRequest)
-	opt.StringInput = strconv.Itoa(newRequest.Size) + " " + newRequest.Board
-	if len(*repo.Jobs) > 0 && repo.Algo == "A*" {
-		fmt.Fprintln(os.Stderr, "Server already running an A* job")
-		c.IndentedJSON(http.StatusOK, gin.H{"status": "BUSY"})
+	if err := GetSolutionByStringInput(solution, repo.Store, opt.StringInput, newRequest.Disposition); err == nil && newRequest.PreviousCompute {
+		fmt.Fprintln(os.Stderr, "Found entry in DB !")
+		c.IndentedJSON(http.StatusOK, gin.H{"status": "DB", "solution": solution.Path, "time": time.Duration(solution.ComputeMs * 1000).String(), "algo": solution.Algo, "bound": solution.Bound})
 		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "No entry found in DB (%s) processing request\n", err.Error())
 	}
-	if err := repo.addStringInputToJobs(opt.StringInput); err != nil {
-		fmt.Fprintln(os.Stderr, "Grid already being processed !")
-		c.IndentedJSON(http.StatusOK, gin.H{"status": "RUNNING"})
+	key, running, err := newRunningSolve(opt)
+	if err != nil {
+		abortWithBadRequest(c, err)
 		return
 	}
-	if err := GetSolutionByStringInput(solution, repo.DB, opt.StringInput, newRequest.Disposition); err == nil && newRequest.PreviousCompute {
-		fmt.Fprintln(os.Stderr, "Found entry in DB !")
-		c.IndentedJSON(http.StatusOK, gin.H{"status": "DB", "solution": solution.Path, "time": time.Duration(solution.ComputeMs * 1000).String(), "algo": solution.Algo})
-		if err := repo.removeStringInputFromJobs(opt.StringInput); err != nil {
-			fmt.Fprintln(os.Stderr, "Failure removing grid from running jobs")
-		}
+	if newRequest.ID != "" {
+		running.ProgressID = requestProgressID(newRequest.ID)
+	}
+	admitCtx, cancel := context.WithTimeout(c.Request.Context(), admissionWait)
+	flight, created, err := repo.Registry.solve(admitCtx, repo.Admission, repo.Progress, opt, key, running, func(ctx context.Context) SolveResponse {
+		return runSolve(ctx, repo.Store, repo.Algo, opt, repo.Progress, running.ProgressID)
+	})
+	cancel()
+	if errors.Is(err, errProgressIDInUse) {
+		abortWithError(c, http.StatusConflict, err.Error())
 		return
 	} else if err != nil {
-		fmt.Fprintf(os.Stderr, "No entry found in DB (%s) processing request\n", err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
+		rejectForMemory(c)
+		return
 	}
-	result, solution := algo.Solve(opt)
-	if result[0] == "OK" && !newRequest.QuickSolve {
-		if err := solution.UpdateOrCreateSolution(repo.DB); err != nil {
-			fmt.Fprintln(os.Stderr, "Failure to save new solution to DB")
-		}
-	} else if result[0] == "PARAM" || result[0] == "FLAGS" {
-		fmt.Fprintln(os.Stderr, "Wrong parameters or flags for solver init")
+	if !created {
+		fmt.Fprintln(os.Stderr, "Grid already being processed : waiting for the running solve")
 	}
-	c.IndentedJSON(http.StatusOK, gin.H{
-		"status":   result[0],
-		"solution": result[1],
-		"time":     result[2],
-		"algo":     repo.Algo,
-		"workers":  opt.Workers,
-	})
-	if repo.removeStringInputFromJobs(opt.StringInput) != nil {
-		fmt.Fprintln(os.Stderr, "Failure removing grid from running jobs")
+	if response, ok := repo.Registry.wait(c.Request.Context(), flight); ok {
+		c.IndentedJSON(http.StatusOK, response)
 	}
 	debug.FreeOSMemory()
 }
 
 func (repo *Repository) Generate(c *gin.Context) {
-	size, err := strconv.Atoi(c.Param("size"))
-	disposition := c.Param("disposition")
-	if disposition != "snail" && disposition != "zerolast" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Wrong Format : " + "Wrong disposition"})
-	}
+	size, err := parseSize(c.Param("size"))
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Wrong Format : " + err.Error()})
+		abortWithBadRequest(c, err)
+		return
+	}
+	disposition := c.Param("disposition")
+	if err := validateDisposition(disposition); err != nil {
+		abortWithBadRequest(c, err)
+		return
 	}
 	board := algo.MatrixToStringHashOnly(algo.GridGenerator(size, disposition), " ")
 	c.IndentedJSON(http.StatusOK, gin.H{"size": size, "board": board})
 }
 
 func (repo *Repository) GetRandomFromDB(c *gin.Context) {
-	size, err := strconv.Atoi(c.Param("size"))
+	size, err := parseSize(c.Param("size"))
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Wrong Format : " + err.Error()})
+		abortWithBadRequest(c, err)
+		return
 	}
 	solution := &models.Solution{}
-	count, err := solution.GetCountBySize(repo.DB, size)
-	fmt.Fprintln(os.Stderr, "Picking random grid from", count, "suitable entries")
+	count, err := repo.Store.CountBySize(size)
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Error Counting grids : " + err.Error()})
+		abortWithError(c, http.StatusInternalServerError, "Error Counting grids : "+err.Error())
+		return
 	}
-	err = solution.GetRandomSolutionBySize(repo.DB, size)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Error Retrieving grids : " + err.Error()})
+	fmt.Fprintln(os.Stderr, "Picking random grid from", count, "suitable entries")
+	if count == 0 {
+		abortWithError(c, http.StatusNotFound, fmt.Sprintf("No grid of size %d in DB", size))
+		return
+	}
+	if err := repo.Store.GetRandomBySize(solution, size); err != nil {
+		abortWithError(c, http.StatusInternalServerError, "Error Retrieving grids : "+err.Error())
+		return
 	}
 	c.IndentedJSON(http.StatusOK, gin.H{"size": solution.Size, "board": strings.Join(strings.Split(solution.Hash, "."), " ")})
 }
@@ -152,16 +191,20 @@ func (repo *Repository) GetRandomFromDB(c *gin.Context) {
 func (repo *Repository) GetSolution(c *gin.Context) {
 	solution := &models.Solution{}
 	var newRequest SolveRequest
-	if err := c.BindJSON(&newRequest); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"msg": "Wrong Format : " + err.Error()})
+	if err := bindRequest(c, "SolveRequest", &newRequest); err != nil {
+		abortWithBadRequest(c, err)
+		return
+	}
+	if err := newRequest.validate(); err != nil {
+		abortWithBadRequest(c, err)
+		return
 	}
 	fmt.Fprintln(os.Stderr, "Received request :", newRequest)
 	StringInput := strconv.Itoa(newRequest.Size) + " " + newRequest.Board
-	if err := GetSolutionByStringInput(solution, repo.DB, StringInput, newRequest.Disposition); err == nil {
-		fmt.Fprintln(os.Stderr, "Found entry in DB !")
-		c.IndentedJSON(http.StatusOK, gin.H{"status": "DB", "solution": solution.Path, "time": time.Duration(solution.ComputeMs * 1000).String(), "algo": solution.Algo})
+	if err := GetSolutionByStringInput(solution, repo.Store, StringInput, newRequest.Disposition); err != nil {
+		abortWithError(c, http.StatusNotFound, "No solution in DB for this board")
 		return
-	} else {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"status": "NOTFOUND"})
 	}
+	fmt.Fprintln(os.Stderr, "Found entry in DB !")
+	c.IndentedJSON(http.StatusOK, gin.H{"status": "DB", "solution": solution.Path, "time": time.Duration(solution.ComputeMs * 1000).String(), "algo": solution.Algo, "bound": solution.Bound})
 }
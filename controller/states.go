@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/models"
+)
+
+// Solutions indexed per read of the solutions table by the backfill
+const backfillBatch = 100
+
+// The suffixes of an optimal path are optimal : every board met along the
+// path of a stored solution is indexed as a models.SolutionState, and
+// served the end of the path
+
+func boardFromHash(hash string, size int) ([][]int, error) {
+	input := strconv.Itoa(size) + " " + strings.ReplaceAll(hash, ".", " ")
+	return algo.ParseInput(bufio.NewScanner(strings.NewReader(input)))
+}
+
+// Boards met along the path of the solution, besides its board and the
+// goal. Suboptimal solutions have none
+func solutionStates(solution *models.Solution) (states []models.SolutionState, err error) {
+	if solution.Bound != 1 {
+		return nil, nil
+	}
+	board, err := boardFromHash(solution.Hash, solution.Size)
+	if err != nil {
+		return nil, err
+	}
+	boards, err := algo.PlayMoves(board, algo.Moves(solution.Path))
+	if err != nil {
+		return nil, err
+	}
+	for offset := 1; offset < len(boards)-1; offset++ {
+		canonical, symmetry := algo.Canonicalize(boards[offset], solution.Disposition)
+		states = append(states, models.SolutionState{Hash: algo.MatrixToStringHashOnly(canonical, "."), Disposition: solution.Disposition, SolutionID: solution.ID, Offset: offset, Symmetry: symmetry.Name})
+	}
+	return states, nil
+}
+
+// Replaces the boards met along the path of the solution in the index. The
+// solution is marked as indexed even when its path can not be played, so
+// that the backfill does not retry it
+func indexSolution(store models.SolutionStore, solution *models.Solution) error {
+	states, playErr := solutionStates(solution)
+	if err := store.IndexSolution(solution, states); err != nil {
+		return err
+	}
+	return playErr
+}
+
+// Indexes the paths of the solutions stored before the index, or whose
+// indexing failed. Returns the number of solutions indexed
+func BackfillStateIndex(store models.SolutionStore, logger algo.Logger) (count int, err error) {
+	for {
+		solutions, err := store.GetUnindexed(backfillBatch)
+		if err != nil || len(solutions) == 0 {
+			return count, err
+		}
+		for i := range solutions {
+			if err := indexSolution(store, &solutions[i]); err != nil && !solutions[i].Indexed {
+				return count, err
+			} else if err != nil {
+				logger.Printf("Solution %d can not be indexed : %s\n", solutions[i].ID, err.Error())
+			} else {
+				count++
+			}
+		}
+	}
+}
+
+// Solution of the board from the index of the boards met along the stored
+// paths. symmetry maps the board to its representative hash
+func getSolutionFromStates(solution *models.Solution, store models.SolutionStore, hash string, disposition string, symmetry algo.Symmetry) error {
+	state := &models.SolutionState{}
+	if err := store.GetState(state, hash, disposition); err != nil {
+		return err
+	}
+	if err := store.GetByID(solution, state.SolutionID); err != nil {
+		return err
+	}
+	stateSymmetry, ok := algo.SymmetryByName(state.Symmetry)
+	if !ok || state.Offset > len(solution.Path) {
+		return errors.New("Corrupted state of solution " + strconv.FormatUint(uint64(solution.ID), 10))
+	}
+	suffix := stateSymmetry.Moves(algo.Moves(solution.Path[state.Offset:]))
+	solution.Path = symmetry.Inverse().Moves(suffix).String()
+	solution.Length = len(solution.Path)
+	return nil
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/fleblay/42-npuzzle/models"
+	"github.com/gin-gonic/gin"
+)
+
+func expectStoredSolution(t *testing.T, router *gin.Engine, board string, solution string) {
+	t.Helper()
+	recorder := serve(router, http.MethodPost, "/solution", `{"size":3,"board":"`+board+`","disposition":"zerolast"}`)
+	var stored struct {
+		Status   string `json:"status"`
+		Solution string `json:"solution"`
+	}
+	decodeBody(t, recorder, &stored)
+	if recorder.Code != http.StatusOK || stored.Status != "DB" || stored.Solution != solution {
+		t.Errorf("Lookup of %s returned %d : %s", board, recorder.Code, recorder.Body.String())
+	}
+}
+
+// Boards met along the path of a new solution are served the end of it
+func TestStateIndex(t *testing.T) {
+	router, _ := newTestRouter(t)
+	recorder := serve(router, http.MethodPost, "/solve/astar", `{"size":3,"board":"1 2 3 0 4 5 7 8 6","disposition":"zerolast"}`)
+	var response SolveResponse
+	decodeBody(t, recorder, &response)
+	if recorder.Code != http.StatusOK || response.Solution != "RRD" {
+		t.Fatalf("Solve returned %d : %s", recorder.Code, recorder.Body.String())
+	}
+	expectStoredSolution(t, router, "1 2 3 4 0 5 7 8 6", "RD")
+	expectStoredSolution(t, router, "1 2 3 4 5 0 7 8 6", "D")
+
+	board := [][]int{{1, 2, 3}, {4, 0, 5}, {7, 8, 6}}
+	image := strings.TrimSpace(algo.MatrixToStringHashOnly(algo.Transpose.Board(board, "zerolast"), " "))
+	expectStoredSolution(t, router, image, "DR")
+}
+
+// Solutions stored before the index are indexed by the backfill, once
+func TestBackfillStateIndex(t *testing.T) {
+	router, store := newTestRouter(t)
+	for _, solution := range []models.Solution{
+		{Size: 3, Hash: "1.2.3.0.4.5.7.8.6.", Path: "RRD", Disposition: "zerolast", Bound: 1},
+		{Size: 3, Hash: "1.2.3.4.5.6.7.0.8.", Path: "UUUU", Disposition: "zerolast", Bound: 1},
+	} {
+		if err := store.Save(&solution); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder := serve(router, http.MethodPost, "/solution", `{"size":3,"board":"1 2 3 4 0 5 7 8 6","disposition":"zerolast"}`)
+	expectError(t, recorder, http.StatusNotFound, "NOTFOUND")
+
+	logger := log.New(io.Discard, "", 0)
+	if count, err := BackfillStateIndex(store, logger); count != 1 || err != nil {
+		t.Errorf("BackfillStateIndex() = %d, %v instead of 1 solution", count, err)
+	}
+	expectStoredSolution(t, router, "1 2 3 4 0 5 7 8 6", "RD")
+	if count, err := BackfillStateIndex(store, logger); count != 0 || err != nil {
+		t.Errorf("BackfillStateIndex() = %d, %v once done", count, err)
+	}
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Part of a schema of /openapi.json checked by the API : references, types,
+// required and nested properties, bounds, enums and patterns
+type schema struct {
+	Ref        string             `json:"$ref"`
+	AllOf      []*schema          `json:"allOf"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	Enum       []string           `json:"enum"`
+	Pattern    string             `json:"pattern"`
+	pattern    *regexp.Regexp
+}
+
+// Schemas of the components of /openapi.json, by name
+var schemas = loadSchemas(openAPIDocument)
+
+func loadSchemas(document []byte) map[string]*schema {
+	var content struct {
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(document, &content); err != nil {
+		panic("Invalid /openapi.json : " + err.Error())
+	}
+	var compile func(current *schema)
+	compile = func(current *schema) {
+		if current.Pattern != "" {
+			current.pattern = regexp.MustCompile(current.Pattern)
+		}
+		for _, child := range current.AllOf {
+			compile(child)
+		}
+		for _, child := range current.Properties {
+			compile(child)
+		}
+	}
+	for _, current := range content.Components.Schemas {
+		compile(current)
+	}
+	return content.Components.Schemas
+}
+
+// Checks value, decoded from JSON, against the schema. name names the value
+// in the errors
+func (current *schema) validate(name string, value any) error {
+	if current.Ref != "" {
+		return schemas[strings.TrimPrefix(current.Ref, "#/components/schemas/")].validate(name, value)
+	}
+	for _, part := range current.AllOf {
+		if err := part.validate(name, value); err != nil {
+			return err
+		}
+	}
+	switch current.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is not an object", name)
+		}
+		for _, property := range current.Required {
+			if _, ok := object[property]; !ok {
+				return fmt.Errorf("%s is required", property)
+			}
+		}
+		for property, child := range current.Properties {
+			if propertyValue, ok := object[property]; ok {
+				if err := child.validate(property, propertyValue); err != nil {
+					return err
+				}
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok || (current.Type == "integer" && number != math.Trunc(number)) {
+			return fmt.Errorf("%s %v is not of type %s", name, value, current.Type)
+		}
+		if current.Minimum != nil && number < *current.Minimum {
+			return fmt.Errorf("%s %v is below %v", name, value, *current.Minimum)
+		}
+		if current.Maximum != nil && number > *current.Maximum {
+			return fmt.Errorf("%s %v is above %v", name, value, *current.Maximum)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s %v is not a string", name, value)
+		}
+		if current.Enum != nil && !contains(current.Enum, text) {
+			return fmt.Errorf("%s %q is not one of %s", name, text, strings.Join(current.Enum, ", "))
+		}
+		if current.pattern != nil && !current.pattern.MatchString(text) {
+			return fmt.Errorf("%s %q does not match %s", name, text, current.Pattern)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s %v is not a boolean", name, value)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the JSON body against the schema named schemaName in /openapi.json,
+// then decodes it into request
+func bindRequest(c *gin.Context, schemaName string, request any) error {
+	body, err := c.GetRawData()
+	if err != nil {
+		return err
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return err
+	}
+	if err := schemas[schemaName].validate("request", value); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, request)
+}
+
+func validateSize(size int) error {
+	return schemas["Size"].validate("size", float64(size))
+}
+
+func parseSize(param string) (int, error) {
+	size, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, fmt.Errorf("size %q is not a number", param)
+	}
+	return size, validateSize(size)
+}
+
+func validateDisposition(disposition string) error {
+	return schemas["Disposition"].validate("disposition", disposition)
+}
+
+// The board holds every tile from 0 to size * size - 1 once, separated by
+// spaces, as the BoardTiles schema describes without a rule to check it
+func validateBoard(size int, board string) error {
+	fields := strings.Fields(board)
+	if len(fields) != size*size {
+		return fmt.Errorf("board has %d tiles instead of %d", len(fields), size*size)
+	}
+	seen := make([]bool, size*size)
+	for _, field := range fields {
+		tile, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("tile %q is not a number", field)
+		}
+		if tile < 0 || tile >= size*size {
+			return fmt.Errorf("tile %d is not between 0 and %d", tile, size*size-1)
+		}
+		if seen[tile] {
+			return fmt.Errorf("tile %d appears more than once", tile)
+		}
+		seen[tile] = true
+	}
+	return nil
+}
+
+// Checks what the schema of the request can not : the tiles of the board
+// against its size
+func (request *SolveRequest) validate() error {
+	return validateBoard(request.Size, request.Board)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fleblay/42-npuzzle/algo"
+	"github.com/gin-gonic/gin"
+)
+
+// Moves to check against a board. Optimal asks for a solve of the board
+// when the lower bound does not prove the moves optimal
+type VerifyRequest struct {
+	Size        int    `json:"size"`
+	Board       string `json:"board"`
+	Disposition string `json:"disposition"`
+	Moves       string `json:"moves"`
+	Optimal     bool   `json:"optimal"`
+	TimeoutMs   int64  `json:"timeoutMs"`
+}
+
+// OptimalError explains why the optimality of solving moves is unknown
+type VerifyResponse struct {
+	algo.Verification
+	OptimalError string `json:"optimalError,omitempty"`
+}
+
+func (request *VerifyRequest) validate() error {
+	solve := SolveRequest{Size: request.Size, Board: request.Board, Disposition: request.Disposition, TimeoutMs: request.TimeoutMs}
+	return solve.validate()
+}
+
+func (repo *Repository) Verify(c *gin.Context) {
+	var newRequest VerifyRequest
+	if err := bindRequest(c, "VerifyRequest", &newRequest); err != nil {
+		abortWithBadRequest(c, err)
+		return
+	}
+	if err := newRequest.validate(); err != nil {
+		abortWithBadRequest(c, err)
+		return
+	}
+	input := strconv.Itoa(newRequest.Size) + " " + newRequest.Board
+	board, err := algo.ParseInput(bufio.NewScanner(strings.NewReader(input)))
+	if err != nil {
+		abortWithBadRequest(c, err)
+		return
+	}
+	response := VerifyResponse{Verification: algo.Verify(board, newRequest.Disposition, algo.Moves(newRequest.Moves))}
+	if newRequest.Optimal && response.Solved && !response.Optimal {
+		opt := newApiOption(repo.Algo, SolveRequest{Size: newRequest.Size, Board: newRequest.Board, Disposition: newRequest.Disposition, TimeoutMs: newRequest.TimeoutMs})
+		admitCtx, cancel := context.WithTimeout(c.Request.Context(), admissionWait)
+		release, err := repo.Admission.acquire(admitCtx, opt, newRequest.Size)
+		cancel()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			rejectForMemory(c)
+			return
+		}
+		err = response.CheckOptimal(c.Request.Context(), board, newRequest.Disposition, *opt)
+		release()
+		if err != nil {
+			response.OptimalError = err.Error()
+		}
+	}
+	c.IndentedJSON(http.StatusOK, response)
+}
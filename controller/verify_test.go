@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	router, _ := newTestRouter(t)
+	test := []struct {
+		moves         string
+		checkOptimal  bool
+		solved        bool
+		optimal       bool
+		illegal       int
+		optimalLength int
+	}{
+		{"RRD", false, true, true, -1, 0},
+		{"L", false, false, false, 0, 0},
+		{"RRDLR", false, true, false, -1, 0},
+		{"RRDLR", true, true, false, -1, 3},
+	}
+	for _, test := range test {
+		body := `{"size":3,"board":"1 2 3 0 4 5 7 8 6","disposition":"zerolast","moves":"` + test.moves + `","optimal":` + strconv.FormatBool(test.checkOptimal) + `}`
+		recorder := serve(router, http.MethodPost, "/verify", body)
+		var response VerifyResponse
+		decodeBody(t, recorder, &response)
+		if recorder.Code != http.StatusOK || response.Solved != test.solved || response.Optimal != test.optimal || response.IllegalMove != test.illegal || response.OptimalLength != test.optimalLength || response.LowerBound != 3 {
+			t.Errorf("Verify of %s returned %d : %s", test.moves, recorder.Code, recorder.Body.String())
+		}
+	}
+	expectError(t, serve(router, http.MethodPost, "/verify", `{"size":3,"board":"1 2 3","disposition":"zerolast","moves":"R"}`), http.StatusBadRequest, "INVALID")
+}
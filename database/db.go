@@ -17,9 +17,10 @@ func ConnectDB(host string) (*gorm.DB, error) {
 	return db, nil
 }
 
+// Migrates the database to the current schema. Returns the number of
+// solutions stored
 func CreateModel(db *gorm.DB) (count int64, err error) {
-	err = db.AutoMigrate(&models.Solution{})
-	if err != nil {
+	if _, err = Migrate(db); err != nil {
 		return -1, err
 	}
 	solution := &models.Solution{}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/models"
+	"gorm.io/gorm"
+)
+
+// Longest line of a JSONL store
+const maxJSONLLine = 1 << 20
+
+// Solutions in a flat file, one JSON solution per line. Saves and deletes
+// append a line : the last line of an id wins, and a line whose DeletedAt
+// is set deletes it. The file is read in memory, then rewritten with a line
+// per solution, when the store is opened. The index of the states is kept
+// in memory only : the solutions read are not indexed
+type JSONLStore struct {
+	*MemoryStore
+	file *os.File
+}
+
+func OpenJSONLStore(path string) (*JSONLStore, error) {
+	store := &JSONLStore{MemoryStore: NewMemoryStore()}
+	if err := store.load(path); err != nil {
+		return nil, fmt.Errorf("Failed to read solution store [%s] : %s", path, err.Error())
+	}
+	if err := store.compact(path); err != nil {
+		return nil, fmt.Errorf("Failed to rewrite solution store [%s] : %s", path, err.Error())
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store.file = file
+	return store, nil
+}
+
+func (store *JSONLStore) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxJSONLLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var solution models.Solution
+		if err := json.Unmarshal(scanner.Bytes(), &solution); err != nil {
+			return fmt.Errorf("line %d : %s", line, err.Error())
+		}
+		if solution.ID == 0 {
+			return fmt.Errorf("line %d : solution without id", line)
+		}
+		if solution.DeletedAt.Valid {
+			store.delete(solution.ID)
+			continue
+		}
+		if stored, ok := store.solutions[solution.ID]; ok {
+			delete(store.boards, boardKey{stored.Hash, stored.Disposition})
+		}
+		solution.Indexed = false
+		store.put(solution)
+	}
+	return scanner.Err()
+}
+
+// Writes the solutions to a new file, then replaces the store with it
+func (store *JSONLStore) compact(path string) error {
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, id := range store.ids() {
+		if err = encoder.Encode(store.solutions[id]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// Appends a line for the solution. The store must be locked
+func (store *JSONLStore) append(solution models.Solution) error {
+	line, err := json.Marshal(solution)
+	if err != nil {
+		return err
+	}
+	_, err = store.file.Write(append(line, '\n'))
+	return err
+}
+
+func (store *JSONLStore) Save(solution *models.Solution) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !store.save(solution) {
+		return nil
+	}
+	return store.append(*solution)
+}
+
+func (store *JSONLStore) Delete(id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deleted, ok := store.solutions[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+	store.delete(id)
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return store.append(deleted)
+}
+
+// Flushes the appended lines to the disk and closes the file. Saves and
+// deletes fail afterwards
+func (store *JSONLStore) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.file.Sync(); err != nil {
+		store.file.Close()
+		return err
+	}
+	return store.file.Close()
+}
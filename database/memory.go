@@ -0,0 +1,230 @@
+package database
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fleblay/42-npuzzle/models"
+	"gorm.io/gorm"
+)
+
+type boardKey struct {
+	hash        string
+	disposition string
+}
+
+// Solutions held by the process, lost when it stops. Deleted solutions are
+// removed, not kept as deleted rows
+type MemoryStore struct {
+	mu          sync.RWMutex
+	lastID      uint
+	lastStateID uint
+	solutions   map[uint]models.Solution
+	boards      map[boardKey]uint
+	states      map[boardKey]models.SolutionState
+	// Boards of the states of each solution
+	indexed map[uint][]boardKey
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{solutions: map[uint]models.Solution{}, boards: map[boardKey]uint{}, states: map[boardKey]models.SolutionState{}, indexed: map[uint][]boardKey{}}
+}
+
+func (store *MemoryStore) GetByHash(solution *models.Solution, hash string, disposition string) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	id, ok := store.boards[boardKey{hash, disposition}]
+	if !ok {
+		return models.ErrNotFound
+	}
+	*solution = store.solutions[id]
+	return nil
+}
+
+func (store *MemoryStore) GetByID(solution *models.Solution, id uint) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	stored, ok := store.solutions[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+	*solution = stored
+	return nil
+}
+
+func (store *MemoryStore) GetRandomBySize(solution *models.Solution, size int) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var ids []uint
+	for id, stored := range store.solutions {
+		if stored.Size == size {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return models.ErrNotFound
+	}
+	*solution = store.solutions[ids[rand.Intn(len(ids))]]
+	return nil
+}
+
+func (store *MemoryStore) Count() (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return int64(len(store.solutions)), nil
+}
+
+func (store *MemoryStore) CountBySize(size int) (count int64, err error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, stored := range store.solutions {
+		if stored.Size == size {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (store *MemoryStore) Save(solution *models.Solution) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.save(solution)
+	return nil
+}
+
+// Same rules as models.Solution.UpdateOrCreateSolution. Returns whether the
+// solution was stored
+func (store *MemoryStore) save(solution *models.Solution) bool {
+	now := time.Now()
+	key := boardKey{solution.Hash, solution.Disposition}
+	if id, ok := store.boards[key]; ok {
+		stored := store.solutions[id]
+		if stored.Optimal && solution.Length >= stored.Length {
+			*solution = stored
+			return false
+		}
+		solution.ID, solution.CreatedAt = id, stored.CreatedAt
+	} else {
+		store.lastID++
+		solution.ID, solution.CreatedAt = store.lastID, now
+	}
+	solution.UpdatedAt, solution.DeletedAt = now, gorm.DeletedAt{}
+	store.put(*solution)
+	return true
+}
+
+// Stores the solution under its id
+func (store *MemoryStore) put(solution models.Solution) {
+	store.solutions[solution.ID] = solution
+	store.boards[boardKey{solution.Hash, solution.Disposition}] = solution.ID
+	if solution.ID > store.lastID {
+		store.lastID = solution.ID
+	}
+}
+
+func (store *MemoryStore) Delete(id uint) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.delete(id)
+}
+
+func (store *MemoryStore) delete(id uint) error {
+	stored, ok := store.solutions[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+	store.deleteStates(id)
+	delete(store.boards, boardKey{stored.Hash, stored.Disposition})
+	delete(store.solutions, id)
+	return nil
+}
+
+func (store *MemoryStore) deleteStates(id uint) {
+	for _, key := range store.indexed[id] {
+		delete(store.states, key)
+	}
+	delete(store.indexed, id)
+}
+
+// Ids of the solutions, in order
+func (store *MemoryStore) ids() []uint {
+	ids := make([]uint, 0, len(store.solutions))
+	for id := range store.solutions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// The store is not locked while fx runs : fx may use it
+func (store *MemoryStore) List(batch int, fx func(solution *models.Solution) error) error {
+	store.mu.RLock()
+	ids := store.ids()
+	store.mu.RUnlock()
+	for _, id := range ids {
+		solution := &models.Solution{}
+		if err := store.GetByID(solution, id); err == models.ErrNotFound {
+			continue
+		}
+		if err := fx(solution); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) GetState(state *models.SolutionState, hash string, disposition string) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	stored, ok := store.states[boardKey{hash, disposition}]
+	if !ok {
+		return models.ErrNotFound
+	}
+	*state = stored
+	return nil
+}
+
+func (store *MemoryStore) IndexSolution(solution *models.Solution, states []models.SolutionState) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	solution.Indexed = true
+	stored, ok := store.solutions[solution.ID]
+	if !ok {
+		return nil
+	}
+	store.deleteStates(solution.ID)
+	for _, state := range states {
+		key := boardKey{state.Hash, state.Disposition}
+		if _, ok := store.states[key]; ok {
+			continue
+		}
+		store.lastStateID++
+		state.ID = store.lastStateID
+		store.states[key] = state
+		store.indexed[solution.ID] = append(store.indexed[solution.ID], key)
+	}
+	stored.Indexed = true
+	store.solutions[solution.ID] = stored
+	return nil
+}
+
+// Nothing to write : the solutions are lost
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+func (store *MemoryStore) GetUnindexed(limit int) (solutions []models.Solution, err error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, id := range store.ids() {
+		if len(solutions) == limit {
+			break
+		}
+		if stored := store.solutions[id]; !stored.Indexed {
+			solutions = append(solutions, stored)
+		}
+	}
+	return solutions, nil
+}
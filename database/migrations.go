@@ -0,0 +1,145 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema change applied once, in the order of the versions. Up runs in a
+// transaction with the record of the version. A migration never changes
+// once released : the tables are described as they were at its version
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// Migration applied to the database
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Tables as they were before the migrations. Databases created by the
+// AutoMigrate of the previous versions are brought to the same schema
+type solutionV1 struct {
+	gorm.Model
+	Size        int
+	Hash        string
+	Solvable    bool
+	Path        string
+	Length      int
+	Algo        string
+	Workers     int
+	Split       int
+	Disposition string
+	ComputeMs   int64
+	Bound       float64 `gorm:"default:1"`
+	Indexed     bool    `gorm:"index"`
+}
+
+func (solutionV1) TableName() string { return "solutions" }
+
+type jobV1 struct {
+	gorm.Model
+	Status          string `gorm:"index"`
+	Algo            string
+	Size            int
+	Board           string
+	Disposition     string
+	PreviousCompute bool
+	QuickSolve      bool
+	TimeoutMs       int64
+	Result          string
+	Error           string
+}
+
+func (jobV1) TableName() string { return "jobs" }
+
+type solutionStateV1 struct {
+	ID          uint   `gorm:"primarykey"`
+	Hash        string `gorm:"uniqueIndex:idx_solution_states_board"`
+	Disposition string `gorm:"uniqueIndex:idx_solution_states_board"`
+	SolutionID  uint
+	Offset      int
+	Symmetry    string
+}
+
+func (solutionStateV1) TableName() string { return "solution_states" }
+
+type solutionV2 struct {
+	Heuristic     string
+	Nodes         int
+	PeakMemory    uint64
+	Optimal       bool
+	SolverVersion string
+}
+
+func (solutionV2) TableName() string { return "solutions" }
+
+var migrations = []migration{
+	{1, "initial schema", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&solutionV1{}, &jobV1{}, &solutionStateV1{})
+	}},
+	{2, "solution metadata", func(tx *gorm.DB) error {
+		for _, column := range []string{"Heuristic", "Nodes", "PeakMemory", "Optimal", "SolverVersion"} {
+			if err := tx.Migrator().AddColumn(&solutionV2{}, column); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE solutions SET optimal = (bound = 1)").Error
+	}},
+	// Of the solutions of a board, the live one is kept first, then the
+	// shortest, then the oldest. The states of the others are dropped
+	{3, "unique solution boards", func(tx *gorm.DB) error {
+		statements := []string{
+			`DELETE FROM solutions WHERE EXISTS (
+				SELECT 1 FROM solutions AS kept
+				WHERE kept.hash = solutions.hash AND kept.disposition = solutions.disposition AND kept.id != solutions.id
+				AND (kept.deleted_at IS NOT NULL, kept.length, kept.id) < (solutions.deleted_at IS NOT NULL, solutions.length, solutions.id))`,
+			"DELETE FROM solution_states WHERE solution_id NOT IN (SELECT id FROM solutions)",
+			"CREATE UNIQUE INDEX idx_solutions_board ON solutions (hash, disposition)",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// Applies the migrations not yet applied to the database. Returns how many
+// were applied
+func Migrate(db *gorm.DB) (applied int, err error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return 0, err
+	}
+	var done []SchemaMigration
+	if err := db.Find(&done).Error; err != nil {
+		return 0, err
+	}
+	versions := map[int]bool{}
+	for _, migration := range done {
+		versions[migration.Version] = true
+	}
+	for _, migration := range migrations {
+		if versions[migration.Version] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("Migration %d (%s) failed : %s", migration.Version, migration.Name, err.Error())
+		}
+		applied++
+	}
+	return applied, nil
+}
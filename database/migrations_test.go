@@ -0,0 +1,109 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/fleblay/42-npuzzle/models"
+	"gorm.io/gorm"
+)
+
+func connectTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := ConnectDB(filepath.Join(t.TempDir(), "solutions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	db := connectTestDB(t)
+	if applied, err := Migrate(db); applied != len(migrations) || err != nil {
+		t.Fatalf("Migrate() = %d, %v on an empty database", applied, err)
+	}
+	if applied, err := Migrate(db); applied != 0 || err != nil {
+		t.Errorf("Migrate() = %d, %v once migrated", applied, err)
+	}
+	for _, column := range []string{"Heuristic", "Nodes", "PeakMemory", "Optimal", "SolverVersion"} {
+		if !db.Migrator().HasColumn(&models.Solution{}, column) {
+			t.Errorf("Column %s is missing", column)
+		}
+	}
+	if !db.Migrator().HasIndex(&models.Solution{}, "idx_solutions_board") {
+		t.Errorf("Unique index on the boards is missing")
+	}
+}
+
+// Databases created before the migrations keep their solutions, one per
+// board
+func TestMigrateExistingDatabase(t *testing.T) {
+	db := connectTestDB(t)
+	if err := db.AutoMigrate(&solutionV1{}, &jobV1{}, &solutionStateV1{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []solutionV1{
+		{Hash: "1.2.3.", Disposition: "snail", Path: "LURD", Length: 4, Bound: 1},
+		{Hash: "1.2.3.", Disposition: "snail", Path: "RD", Length: 2, Bound: 1},
+		{Hash: "1.2.3.", Disposition: "snail", Path: "R", Length: 1, Bound: 1},
+		{Hash: "1.2.3.", Disposition: "zerolast", Path: "DDRR", Length: 4, Bound: 2},
+	}
+	for i := range rows {
+		if err := db.Create(&rows[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Delete(&rows[2])
+	db.Create(&solutionStateV1{Hash: "4.5.6.", Disposition: "snail", SolutionID: rows[0].ID})
+
+	if _, err := CreateModel(db); err != nil {
+		t.Fatal(err)
+	}
+	var solutions []models.Solution
+	db.Unscoped().Order("id").Find(&solutions)
+	if len(solutions) != 2 || solutions[0].Path != "RD" || !solutions[0].Optimal || solutions[1].Optimal {
+		t.Errorf("Migrated solutions %+v", solutions)
+	}
+	var states int64
+	db.Model(&models.SolutionState{}).Count(&states)
+	if states != 0 {
+		t.Errorf("%d states of removed solutions left", states)
+	}
+}
+
+func TestUpdateOrCreateSolution(t *testing.T) {
+	db := connectTestDB(t)
+	if _, err := CreateModel(db); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			solution := &models.Solution{Hash: "1.2.3.", Disposition: "snail", Path: "RD", Length: 2, Bound: 1, Optimal: true, Workers: i}
+			if err := solution.UpdateOrCreateSolution(db); err != nil || solution.ID == 0 {
+				t.Errorf("Concurrent save returned %v with id %d", err, solution.ID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if count, _ := (&models.Solution{}).GetCount(db); count != 1 {
+		t.Errorf("Concurrent saves of a board stored %d solutions", count)
+	}
+
+	longer := &models.Solution{Hash: "1.2.3.", Disposition: "snail", Path: "LURD", Length: 4, Bound: 1, Optimal: true}
+	if err := longer.UpdateOrCreateSolution(db); err != nil || longer.Path != "RD" {
+		t.Errorf("A longer solution replaced the stored one : %+v, %v", longer, err)
+	}
+	stored := &models.Solution{Hash: "1.2.3.", Disposition: "snail", Path: "DRUL", Length: 4, Bound: 1.5}
+	if err := stored.GetSolutionByHash(db, "1.2.3.", "snail"); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(stored).Updates(map[string]any{"path": "DRUL", "length": 4, "optimal": false})
+	shorter := &models.Solution{Hash: "1.2.3.", Disposition: "snail", Path: "RD", Length: 2, Bound: 1, Optimal: true}
+	if err := shorter.UpdateOrCreateSolution(db); err != nil || shorter.Path != "RD" || shorter.ID != stored.ID {
+		t.Errorf("A shorter solution did not replace the stored one : %+v, %v", shorter, err)
+	}
+}
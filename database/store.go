@@ -0,0 +1,154 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fleblay/42-npuzzle/models"
+	"gorm.io/gorm"
+)
+
+// Kinds of solution stores
+const (
+	StoreSQLite = "sqlite"
+	StoreMemory = "memory"
+	StoreJSONL  = "jsonl"
+)
+
+// Default files of the stores
+const (
+	DefaultSQLitePath = "solutions.db"
+	DefaultJSONLPath  = "solutions.jsonl"
+)
+
+// Opens the solution store of kind, SQLite by default, kept in the file
+// path, or in the default file of the kind when empty. The SQLite database
+// is migrated
+func OpenStore(kind string, path string) (models.SolutionStore, error) {
+	switch kind {
+	case "", StoreSQLite:
+		if path == "" {
+			path = DefaultSQLitePath
+		}
+		db, err := ConnectDB(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := CreateModel(db); err != nil {
+			return nil, err
+		}
+		return NewSQLiteStore(db), nil
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreJSONL:
+		if path == "" {
+			path = DefaultJSONLPath
+		}
+		return OpenJSONLStore(path)
+	}
+	return nil, fmt.Errorf("Unknown solution store [%s] : use %s, %s or %s", kind, StoreSQLite, StoreMemory, StoreJSONL)
+}
+
+// File of the jobs with the stores other than SQLite, next to the file of the
+// store
+const DefaultJobsFile = "jobs.db"
+
+// Database of the jobs, and the function closing it. The jobs of the SQLite
+// store are kept in its database, closed with the store. With the other
+// stores they are kept in the SQLite file path, or when empty in
+// DefaultJobsFile in the directory of storePath, the file of the store
+func OpenJobsDB(store models.SolutionStore, path string, storePath string) (db *gorm.DB, close func() error, err error) {
+	if sqlite, ok := store.(*SQLiteStore); ok {
+		return sqlite.DB, func() error { return nil }, nil
+	}
+	if path == "" {
+		path = filepath.Join(filepath.Dir(storePath), DefaultJobsFile)
+	}
+	if db, err = ConnectDB(path); err != nil {
+		return nil, nil, err
+	}
+	jobs := NewSQLiteStore(db)
+	if _, err := CreateModel(db); err != nil {
+		jobs.Close()
+		return nil, nil, err
+	}
+	return db, jobs.Close, nil
+}
+
+// Solutions in the tables of a database migrated by CreateModel. Gets
+// clear their argument : gorm would look for its primary key
+type SQLiteStore struct {
+	DB *gorm.DB
+}
+
+func NewSQLiteStore(db *gorm.DB) *SQLiteStore {
+	return &SQLiteStore{DB: db}
+}
+
+func (store *SQLiteStore) GetByHash(solution *models.Solution, hash string, disposition string) error {
+	*solution = models.Solution{}
+	return solution.GetSolutionByHash(store.DB, hash, disposition)
+}
+
+func (store *SQLiteStore) GetByID(solution *models.Solution, id uint) error {
+	*solution = models.Solution{}
+	return solution.GetSolutionById(store.DB, id)
+}
+
+func (store *SQLiteStore) GetRandomBySize(solution *models.Solution, size int) error {
+	*solution = models.Solution{}
+	return solution.GetRandomSolutionBySize(store.DB, size)
+}
+
+func (store *SQLiteStore) Count() (int64, error) {
+	return (&models.Solution{}).GetCount(store.DB)
+}
+
+func (store *SQLiteStore) CountBySize(size int) (int64, error) {
+	return (&models.Solution{}).GetCountBySize(store.DB, size)
+}
+
+func (store *SQLiteStore) Save(solution *models.Solution) error {
+	return solution.UpdateOrCreateSolution(store.DB)
+}
+
+func (store *SQLiteStore) Delete(id uint) error {
+	res := store.DB.Delete(&models.Solution{}, id)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return models.ErrNotFound
+	} else if res.Error != nil {
+		return res.Error
+	}
+	return models.DeleteStatesOfSolution(store.DB, id)
+}
+
+func (store *SQLiteStore) List(batch int, fx func(solution *models.Solution) error) error {
+	return models.ForEachSolution(store.DB, batch, fx)
+}
+
+func (store *SQLiteStore) GetState(state *models.SolutionState, hash string, disposition string) error {
+	*state = models.SolutionState{}
+	return state.GetStateByHash(store.DB, hash, disposition)
+}
+
+func (store *SQLiteStore) IndexSolution(solution *models.Solution, states []models.SolutionState) error {
+	if err := models.DeleteStatesOfSolution(store.DB, solution.ID); err != nil {
+		return err
+	}
+	if err := models.CreateStates(store.DB, states); err != nil {
+		return err
+	}
+	return solution.SetIndexed(store.DB)
+}
+
+func (store *SQLiteStore) Close() error {
+	db, err := store.DB.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func (store *SQLiteStore) GetUnindexed(limit int) ([]models.Solution, error) {
+	return models.GetUnindexedSolutions(store.DB, limit)
+}
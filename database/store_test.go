@@ -0,0 +1,209 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fleblay/42-npuzzle/models"
+)
+
+// Empty store of each kind
+func testStores(t *testing.T) map[string]models.SolutionStore {
+	t.Helper()
+	db := connectTestDB(t)
+	if _, err := CreateModel(db); err != nil {
+		t.Fatal(err)
+	}
+	jsonl, err := OpenJSONLStore(filepath.Join(t.TempDir(), "solutions.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jsonl.Close() })
+	return map[string]models.SolutionStore{StoreSQLite: NewSQLiteStore(db), StoreMemory: NewMemoryStore(), StoreJSONL: jsonl}
+}
+
+func TestSolutionStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			solution := &models.Solution{}
+			if err := store.GetByHash(solution, "1.2.3.", "snail"); err != models.ErrNotFound {
+				t.Errorf("GetByHash() = %v on an empty store", err)
+			}
+			if err := store.GetRandomBySize(solution, 3); err != models.ErrNotFound {
+				t.Errorf("GetRandomBySize() = %v on an empty store", err)
+			}
+			first := &models.Solution{Size: 3, Hash: "1.2.3.", Disposition: "snail", Path: "LURD", Length: 4, Bound: 1, Optimal: true}
+			second := &models.Solution{Size: 4, Hash: "4.5.6.", Disposition: "snail", Path: "R", Length: 1, Bound: 1, Optimal: true}
+			for _, solution := range []*models.Solution{first, second} {
+				if err := store.Save(solution); err != nil || solution.ID == 0 {
+					t.Fatalf("Save() = %v with id %d", err, solution.ID)
+				}
+			}
+			longer := &models.Solution{Size: 3, Hash: "1.2.3.", Disposition: "snail", Path: "LURDLURD", Length: 8, Bound: 1, Optimal: true}
+			if err := store.Save(longer); err != nil || longer.ID != first.ID || longer.Path != "LURD" {
+				t.Errorf("Save() of a longer solution gave %+v, %v", longer, err)
+			}
+			shorter := &models.Solution{Size: 3, Hash: "1.2.3.", Disposition: "snail", Path: "RD", Length: 2, Bound: 1, Optimal: true}
+			if err := store.Save(shorter); err != nil || shorter.ID != first.ID || shorter.Path != "RD" {
+				t.Errorf("Save() of a shorter solution gave %+v, %v", shorter, err)
+			}
+			if err := store.GetByHash(solution, "1.2.3.", "snail"); err != nil || solution.Path != "RD" {
+				t.Errorf("GetByHash() = %+v, %v", solution, err)
+			}
+			if err := store.GetByID(solution, second.ID); err != nil || solution.Hash != "4.5.6." {
+				t.Errorf("GetByID() = %+v, %v", solution, err)
+			}
+			if err := store.GetRandomBySize(solution, 4); err != nil || solution.ID != second.ID {
+				t.Errorf("GetRandomBySize() = %+v, %v", solution, err)
+			}
+			if count, err := store.Count(); count != 2 || err != nil {
+				t.Errorf("Count() = %d, %v", count, err)
+			}
+			if count, err := store.CountBySize(3); count != 1 || err != nil {
+				t.Errorf("CountBySize() = %d, %v", count, err)
+			}
+
+			if unindexed, err := store.GetUnindexed(1); len(unindexed) != 1 || unindexed[0].ID != first.ID || err != nil {
+				t.Errorf("GetUnindexed() = %+v, %v", unindexed, err)
+			}
+			states := []models.SolutionState{{Hash: "7.8.9.", Disposition: "snail", SolutionID: first.ID, Offset: 1, Symmetry: "identity"}}
+			if err := store.IndexSolution(first, states); err != nil || !first.Indexed {
+				t.Errorf("IndexSolution() = %v", err)
+			}
+			state := &models.SolutionState{}
+			if err := store.GetState(state, "7.8.9.", "snail"); err != nil || state.SolutionID != first.ID || state.Offset != 1 {
+				t.Errorf("GetState() = %+v, %v", state, err)
+			}
+			if unindexed, err := store.GetUnindexed(10); len(unindexed) != 1 || unindexed[0].ID != second.ID || err != nil {
+				t.Errorf("GetUnindexed() = %+v, %v once indexed", unindexed, err)
+			}
+
+			if err := store.Delete(first.ID); err != nil {
+				t.Errorf("Delete() = %v", err)
+			}
+			if err := store.Delete(first.ID); err != models.ErrNotFound {
+				t.Errorf("Delete() = %v once deleted", err)
+			}
+			if err := store.GetState(state, "7.8.9.", "snail"); err != models.ErrNotFound {
+				t.Errorf("GetState() = %v for a deleted solution", err)
+			}
+			var listed []uint
+			err := store.List(1, func(solution *models.Solution) error {
+				listed = append(listed, solution.ID)
+				return nil
+			})
+			if err != nil || len(listed) != 1 || listed[0] != second.ID {
+				t.Errorf("List() = %v, %v", listed, err)
+			}
+		})
+	}
+}
+
+func TestOpenJSONLStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "solutions.jsonl")
+	store, err := OpenJSONLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := &models.Solution{Size: 3, Hash: "1.2.3.", Disposition: "snail", Path: "LURD", Length: 4, Bound: 1, Optimal: true}
+	deleted := &models.Solution{Size: 3, Hash: "4.5.6.", Disposition: "snail", Path: "R", Length: 1, Bound: 1, Optimal: true}
+	for _, solution := range []*models.Solution{kept, deleted, {Size: 3, Hash: "1.2.3.", Disposition: "snail", Path: "RD", Length: 2, Bound: 1, Optimal: true}} {
+		if err := store.Save(solution); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.IndexSolution(kept, nil)
+	store.Delete(deleted.ID)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&models.Solution{Size: 3, Hash: "7.8.9.", Disposition: "snail", Path: "U", Length: 1}); err == nil {
+		t.Errorf("Save() succeeded on a closed store")
+	}
+
+	if store, err = OpenJSONLStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	solution := &models.Solution{}
+	if err := store.GetByHash(solution, "1.2.3.", "snail"); err != nil || solution.Path != "RD" || solution.ID != kept.ID || solution.Indexed {
+		t.Errorf("Reopened store holds %+v, %v", solution, err)
+	}
+	if count, _ := store.Count(); count != 1 {
+		t.Errorf("Reopened store holds %d solutions", count)
+	}
+	added := &models.Solution{Size: 3, Hash: "7.8.9.", Disposition: "snail", Path: "U", Length: 1}
+	if err := store.Save(added); err != nil || added.ID == 0 || added.ID == kept.ID {
+		t.Errorf("Save() = %v with id %d", err, added.ID)
+	}
+	content, err := os.ReadFile(path)
+	if lines := strings.Count(string(content), "\n"); err != nil || lines != 2 {
+		t.Errorf("Store file holds %d lines, %v", lines, err)
+	}
+
+	os.WriteFile(path, []byte("{\"ID\":1}\nnot json\n"), 0644)
+	if _, err := OpenJSONLStore(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("OpenJSONLStore() = %v on a corrupt file", err)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "custom.db")
+	store, err := OpenStore(StoreSQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&models.Solution{Size: 3, Hash: "1.2.3.", Disposition: "snail", Path: "R", Length: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if reopened, err := OpenStore("", path); err != nil {
+		t.Fatal(err)
+	} else if count, _ := reopened.Count(); count != 1 {
+		t.Errorf("SQLite store at %s holds %d solutions", path, count)
+	}
+	if db, _, err := OpenJobsDB(store, "", path); err != nil || db != store.(*SQLiteStore).DB {
+		t.Errorf("Jobs of the SQLite store are not kept in its database : %v", err)
+	}
+	if _, err := OpenStore(StoreJSONL, filepath.Join(dir, "custom.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"custom.db", "custom.jsonl"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("Store file %s : %v", file, err)
+		}
+	}
+	if _, err := OpenStore("postgres", ""); err == nil {
+		t.Errorf("OpenStore() accepted an unknown kind")
+	}
+}
+
+func TestOpenJobsDB(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "solutions.jsonl")
+	store, err := OpenStore(StoreJSONL, storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for path, file := range map[string]string{"": filepath.Join(dir, DefaultJobsFile), filepath.Join(dir, "custom.db"): filepath.Join(dir, "custom.db")} {
+		db, close, err := OpenJobsDB(store, path, storePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Jobs database %s : %v", file, err)
+		}
+		if !db.Migrator().HasTable(&models.Job{}) {
+			t.Errorf("Jobs database %s is not migrated", file)
+		}
+		if err := close(); err != nil {
+			t.Errorf("Closing the jobs database %s : %v", file, err)
+		}
+		if sqlDB, _ := db.DB(); sqlDB.Ping() == nil {
+			t.Errorf("Jobs database %s still open once closed", file)
+		}
+	}
+}
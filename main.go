@@ -1,12 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fleblay/42-npuzzle/algo"
 	"github.com/fleblay/42-npuzzle/controller"
 	"github.com/fleblay/42-npuzzle/database"
+	"github.com/fleblay/42-npuzzle/models"
 	"github.com/gin-gonic/gin"
 
 	//FOR CORS
@@ -21,10 +31,46 @@ import (
 	"syscall"
 )
 
+// Jobs solved at the same time by the API, unless set with JOB_WORKERS
+const defaultJobWorkers = 2
+
+// Memory shared by the solves of the API : MEMORY_BUDGET_MB, or the RAM
+// available at startup
+func admissionBudget() uint64 {
+	if budget, err := strconv.ParseUint(os.Getenv("MEMORY_BUDGET_MB"), 10, 64); err == nil {
+		return budget << 20
+	}
+	budget, err := controller.DefaultAdmissionBudget()
+	handleFatalError(err)
+	return budget
+}
+
+// Run before the process exits on a signal or an error
+var exitHooks struct {
+	sync.Mutex
+	hooks []func()
+}
+
+func onExit(hook func()) {
+	exitHooks.Lock()
+	defer exitHooks.Unlock()
+	exitHooks.hooks = append(exitHooks.hooks, hook)
+}
+
+func exit(code int) {
+	exitHooks.Lock()
+	for _, hook := range exitHooks.hooks {
+		hook()
+	}
+	exitHooks.hooks = nil
+	exitHooks.Unlock()
+	os.Exit(code)
+}
+
 func handleFatalError(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error :", err.Error())
-		os.Exit(1)
+		exit(1)
 	}
 }
 
@@ -34,10 +80,32 @@ func handleSignals() {
 	go func() {
 		<-sigc
 		fmt.Fprintln(os.Stderr, "\b\bExiting after receiving a signal")
-		os.Exit(1)
+		exit(1)
 	}()
 }
 
+// Messages of the solver are only shown in debug mode
+func newLogger(opt *algo.Option) algo.Logger {
+	if !opt.Debug {
+		return nil
+	}
+	return log.New(os.Stderr, "", 0)
+}
+
+// Searches keeping their states only run the garbage collector close to the
+// memory limit. IDA* stores little and keeps the default behaviour
+func setMemoryLimit(opt *algo.Option) {
+	ida := opt.Algo == "ida" || (opt.Algo == "" && !opt.NoIterativeDepth)
+	if opt.RAMMaxGB > 1 && !ida {
+		fmt.Fprintf(os.Stderr, "Solver will use a soft maxmimum of %d Gb and a hard maximum of %d Gb of RAM\n", opt.RAMMaxGB-1, opt.RAMMaxGB)
+		debug.SetMemoryLimit(int64((opt.RAMMaxGB - 1) << 30))
+		debug.SetGCPercent(-1)
+	} else {
+		debug.SetMemoryLimit(int64(opt.RAMMaxGB << 30))
+		debug.SetGCPercent(200)
+	}
+}
+
 func parseFlags(opt *algo.Option) {
 	flagSet := &flag.FlagSet{}
 	flagSet.SetOutput(os.Stderr)
@@ -47,28 +115,171 @@ func parseFlags(opt *algo.Option) {
 	flagSet.IntVar(&opt.MapSize, "s", 3, "usage : -s [board_size]. Use a board randomly generated of selected size")
 	flagSet.StringVar(&opt.Heuristic, "h", "astar_manhattan_conflict", "usage : -h [heuristic]")
 	flagSet.IntVar(&opt.Workers, "w", 8, "usage : -w [workers] between 1 and 32")
-	flagSet.IntVar(&opt.SeenNodesSplit, "split", 96, "usage : -split [setNodesSplit] between 1 and 96")
+	flagSet.IntVar(&opt.SeenNodesSplit, "split", 96, "usage : -split [setNodesSplit] between 1 and 96. Ignored by A* : each worker owns its closed set")
 	flagSet.IntVar(&opt.SpeedDisplay, "speed", 100, "usage : -speed [speedDisplay] between 1 and 2048")
-	flagSet.BoolVar(&opt.NoIterativeDepth, "no-i", false, "usage : -no-i. Use A* instead of Iterative Depth A* (aka IDA*). WAY faster but increase A LOT memory consumption")
+	flagSet.BoolVar(&opt.NoIterativeDepth, "no-i", false, "usage : -no-i. Same as -algo astar")
+	flagSet.StringVar(&opt.Algo, "algo", "", "usage : -algo [ida | astar | bidir | arastar]. Iterative Depth A* (aka IDA*, default), A* (WAY faster but increase A LOT memory consumption), bidirectional MM search or Anytime Repairing A*")
+	flagSet.Float64Var(&opt.Epsilon, "epsilon", 0, "usage : -epsilon [epsilon] between 1 and 10. Weight of the heuristic : solutions are at most epsilon times longer than optimal. Starting epsilon of ARA* (default 3)")
+	flagSet.DurationVar(&opt.Timeout, "timeout", 0, "usage : -timeout [duration]. Ex : '30s'. Stops the search once passed")
+	flagSet.DurationVar(&opt.Deadline, "deadline", 0, "usage : -deadline [duration]. Ex : '2s'. ARA* returns its best solution once passed")
 	flagSet.BoolVar(&opt.Debug, "d", false, "usage : -d. Activate debug info")
 	flagSet.BoolVar(&opt.DisableUI, "no-ui", false, "usage : -no-ui. Disable pretty display of solution")
 	flagSet.Uint64Var(&opt.RAMMaxGB, "ram", 8, "usage : -ram [MaxRamGb] between 1 and 16")
 	flagSet.StringVar(&opt.Disposition, "dispo", "snail", "usage : -dispo [snail | zerolast]")
+	flagSet.Float64Var(&opt.TTShare, "tt", 0, "usage : -tt [share]. Share of -ram between 0 and 0.9 used by the IDA* transposition table. 0 disables it")
+	flagSet.StringVar(&opt.Partition, "partition", "", "usage : -partition [partition]. Tile partition of the pattern database used by astar_pdb, in groups of at most 7 tiles, 5 past 4x4. Ex : '6-6-3'")
+	flagSet.StringVar(&opt.Verify, "verify", "", "usage : -verify [moves]. Ex : 'RRD'. Checks that the moves solve the board of -f or -string instead of solving it, then solves it if needed to prove them optimal")
 
 	flagSet.Parse(os.Args[1:])
 }
 
+func runPatternDatabaseCommand(args []string) {
+	if len(args) == 0 || (args[0] != "build" && args[0] != "verify") {
+		handleFatalError(errors.New("usage : pdb [build | verify] -s [board_size] -dispo [snail | zerolast] -p [partition]"))
+	}
+	flagSet := &flag.FlagSet{}
+	flagSet.SetOutput(os.Stderr)
+
+	size := flagSet.Int("s", 4, "usage : -s [board_size]")
+	disposition := flagSet.String("dispo", "snail", "usage : -dispo [snail | zerolast]")
+	partition := flagSet.String("p", "", "usage : -p [partition]. Ex : '6-6-3'. Groups have at most 7 tiles and a group build may use 1 GB : 7 tiles on 4x4, 5 on 5x5. Defaults to the partition used by the solver for this size")
+	samples := flagSet.Int("n", 10, "usage : -n [samples]. Number of random boards checked by pdb verify")
+	timeout := flagSet.Duration("timeout", time.Minute, "usage : -timeout [duration]. Ex : '30s'. Time given to the solve of each board of pdb verify, skipped once passed. 0 for no limit")
+
+	flagSet.Parse(args[1:])
+	if *partition == "" {
+		*partition = algo.DefaultPartitions[*size]
+	}
+	filename := algo.PatternDatabaseFile(*size, *disposition, *partition)
+	switch args[0] {
+	case "build":
+		start := time.Now()
+		db, err := algo.BuildPatternDatabase(*size, *disposition, *partition, log.New(os.Stderr, "", 0))
+		handleFatalError(err)
+		handleFatalError(db.Save(filename))
+		fmt.Printf("Pattern database saved to %s in %s\n", filename, time.Since(start))
+	case "verify":
+		db, err := algo.LoadPatternDatabase(filename)
+		handleFatalError(err)
+		violations, skipped := algo.VerifyPatternDatabase(db, *samples, *timeout, log.New(os.Stderr, "", 0))
+		if violations > 0 {
+			handleFatalError(fmt.Errorf("Pattern database %s overestimated %d of %d boards", filename, violations, *samples-skipped))
+		}
+		fmt.Printf("Pattern database %s is admissible on %d random boards, %d skipped past the timeout\n", filename, *samples-skipped, skipped)
+	}
+}
+
+// Board given with -f or -string
+func readBoard(opt *algo.Option) ([][]int, error) {
+	if opt.Filename != "" {
+		fd, err := algo.OpenFile(opt.Filename)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		return algo.ParseInput(bufio.NewScanner(fd))
+	} else if opt.StringInput != "" {
+		return algo.ParseInput(bufio.NewScanner(strings.NewReader(opt.StringInput)))
+	}
+	return nil, errors.New("-verify checks the board given with -f or -string")
+}
+
+func runVerify(opt *algo.Option) {
+	board, err := readBoard(opt)
+	handleFatalError(err)
+	verification := algo.Verify(board, opt.Disposition, algo.Moves(opt.Verify))
+	if !verification.Solved {
+		fmt.Printf("Moves do not solve the board : %s\n", verification.Error)
+		fmt.Printf("Board after %d moves : %s\n", verification.Played, algo.MatrixToStringHashOnly(verification.Final, " "))
+		exit(1)
+	}
+	if err := verification.CheckOptimal(context.Background(), board, opt.Disposition, *opt, algo.WithLogger(newLogger(opt))); err != nil {
+		fmt.Printf("Moves solve the board in %d moves, at least %d are needed. %s\n", verification.Length, verification.LowerBound, err.Error())
+	} else if verification.Optimal {
+		fmt.Printf("Moves solve the board optimally in %d moves\n", verification.Length)
+	} else {
+		fmt.Printf("Moves solve the board in %d moves instead of %d\n", verification.Length, verification.OptimalLength)
+	}
+}
+
+func runDatabaseCommand(args []string) {
+	if len(args) == 0 || (args[0] != "backfill" && args[0] != "audit") {
+		handleFatalError(errors.New("usage : db [backfill | audit] -db [file]"))
+	}
+	flagSet := &flag.FlagSet{}
+	flagSet.SetOutput(os.Stderr)
+
+	host := flagSet.String("db", os.Getenv("SOLUTION_STORE_PATH"), "usage : -db [file]. File of the solution store picked by SOLUTION_STORE. Defaults to SOLUTION_STORE_PATH, then to the default file of the store")
+	optimal := flagSet.Bool("optimal", false, "usage : -optimal. db audit solves again the optimal solutions not proven by their lower bound")
+	timeout := flagSet.Duration("timeout", 0, "usage : -timeout [duration]. Ex : '30s'. Time given to each solve of db audit -optimal")
+
+	flagSet.Parse(args[1:])
+	store, err := database.OpenStore(os.Getenv("SOLUTION_STORE"), *host)
+	handleFatalError(err)
+	onExit(func() { store.Close() })
+	defer store.Close()
+	switch args[0] {
+	case "backfill":
+		start := time.Now()
+		count, err := controller.BackfillStateIndex(store, log.New(os.Stderr, "", 0))
+		handleFatalError(err)
+		fmt.Printf("Indexed the paths of %d solutions in %s\n", count, time.Since(start))
+	case "audit":
+		var solver *algo.Option
+		if *optimal {
+			solver = &algo.Option{Timeout: *timeout}
+			algo.InitOptionForApiUse(solver, "IDA")
+			solver.Debug = false
+		}
+		audited, corrupt, err := controller.AuditSolutions(context.Background(), store, solver, func(solution *models.Solution, problems []string) {
+			fmt.Printf("Solution %d (%s %s) : %s\n", solution.ID, solution.Disposition, solution.Hash, strings.Join(problems, ", "))
+		})
+		handleFatalError(err)
+		fmt.Printf("Audited %d solutions : %d corrupt\n", audited, corrupt)
+		if corrupt > 0 {
+			exit(1)
+		}
+	}
+}
+
 func main() {
 	handleSignals()
 
-	if os.Getenv("API") == "true" {
-		db, err := database.ConnectDB("solutions.db")
+	if len(os.Args) > 1 && os.Args[1] == "pdb" {
+		runPatternDatabaseCommand(os.Args[2:])
+	} else if len(os.Args) > 1 && os.Args[1] == "db" {
+		runDatabaseCommand(os.Args[2:])
+	} else if os.Getenv("API") == "true" {
+		// SOLUTION_STORE is sqlite (default), memory or jsonl, kept in the file
+		// SOLUTION_STORE_PATH. Jobs are kept in the SQLite store, or with the
+		// other stores in the SQLite file JOBS_DB_PATH, jobs.db next to the
+		// store by default
+		store, err := database.OpenStore(os.Getenv("SOLUTION_STORE"), os.Getenv("SOLUTION_STORE_PATH"))
+		handleFatalError(err)
+		onExit(func() { store.Close() })
+		db, closeJobs, err := database.OpenJobsDB(store, os.Getenv("JOBS_DB_PATH"), os.Getenv("SOLUTION_STORE_PATH"))
 		handleFatalError(err)
-		count, err := database.CreateModel(db)
+		onExit(func() { closeJobs() })
+		count, err := store.Count()
 		fmt.Printf("Successfully connected to DB with %d items\n", count)
 		handleFatalError(err)
-		repoASTAR := controller.Repository{DB: db, Algo: "A*", Jobs: &[]string{}}
-		repoIDA := controller.Repository{DB: db, Algo: "IDA", Jobs: &[]string{}}
+		go func() {
+			if count, err := controller.BackfillStateIndex(store, log.New(os.Stderr, "", 0)); err != nil {
+				fmt.Fprintln(os.Stderr, "Failure indexing the stored paths :", err.Error())
+			} else if count > 0 {
+				fmt.Printf("Indexed the paths of %d stored solutions\n", count)
+			}
+		}()
+		progress := controller.NewProgressHub()
+		registry := controller.NewJobRegistry()
+		admission := controller.NewAdmissionController(admissionBudget())
+		jobWorkers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+		if err != nil || jobWorkers < 1 {
+			jobWorkers = defaultJobWorkers
+		}
+		jobs := controller.NewJobQueue(db, store, registry, admission, progress, jobWorkers)
+		handleFatalError(jobs.Start())
+		setMemoryLimit(&algo.Option{Algo: "ida", RAMMaxGB: 6})
 
 		gin.SetMode(gin.ReleaseMode)
 		router := gin.Default()
@@ -76,11 +287,7 @@ func main() {
 		//Should ONLY be used for testing in dev env
 		//router.Use(cors.Default())
 
-		router.POST("/solve/ida", repoIDA.Solve)
-		router.POST("/solve/astar", repoASTAR.Solve)
-		router.POST("/solution", repoIDA.GetSolution)
-		router.GET("/generate/:size/:disposition", repoIDA.Generate)
-		router.GET("/pick/:size", repoIDA.GetRandomFromDB)
+		controller.Routes(router, store, registry, admission, progress, jobs)
 
 		listen := os.Getenv("LISTEN")
 		if listen != "" {
@@ -101,8 +308,16 @@ func main() {
 		*/
 		opt := &algo.Option{}
 		parseFlags(opt)
-		res, _ := algo.Solve(opt)
-		fmt.Println(res)
+		setMemoryLimit(opt)
+		if opt.Verify != "" {
+			runVerify(opt)
+			return
+		}
+		outcome, solution := algo.NewSolver(*opt, algo.WithLogger(newLogger(opt))).Solve(context.Background())
+		if solution != nil && !opt.DisableUI {
+			algo.DisplayBoard(outcome.Board, outcome.Moves, outcome.Heuristic, outcome.Duration.String(), outcome.Nodes, outcome.ClosedSet, solution.Workers, solution.Split, opt.SpeedDisplay)
+		}
+		fmt.Println(outcome)
 		//wg.Wait()
 	}
 }
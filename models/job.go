@@ -0,0 +1,57 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Solve request waiting in the queue or already processed. Result holds the
+// JSON response of the solve once the job is over
+type Job struct {
+	gorm.Model
+	Status          string `json:"status" gorm:"index"`
+	Algo            string `json:"algo"`
+	Size            int    `json:"size"`
+	Board           string `json:"board"`
+	Disposition     string `json:"disposition"`
+	PreviousCompute bool   `json:"previousCompute"`
+	QuickSolve      bool   `json:"quickSolve"`
+	TimeoutMs       int64  `json:"timeoutMs"`
+	Result          string `json:"-"`
+	Error           string `json:"error,omitempty"`
+}
+
+func (job *Job) CreateJob(db *gorm.DB) error {
+	return db.Create(job).Error
+}
+
+func (job *Job) GetJobById(db *gorm.DB, id uint) error {
+	return db.Model(&Job{}).First(job, id).Error
+}
+
+func (job *Job) UpdateJob(db *gorm.DB) error {
+	return db.Save(job).Error
+}
+
+// Oldest job with this status, ErrRecordNotFound if there is none. Find is
+// used instead of First, which logs every empty poll of the queue
+func (job *Job) GetFirstJobByStatus(db *gorm.DB, status string) error {
+	res := db.Model(&Job{}).Where("status = ?", status).Order("id").Limit(1).Find(job)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// Jobs left running by a previous process go back to the queue
+func RequeueRunningJobs(db *gorm.DB) (int64, error) {
+	res := db.Model(&Job{}).Where("status = ?", JobRunning).Update("status", JobQueued)
+	return res.RowsAffected, res.Error
+}
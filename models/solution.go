@@ -2,20 +2,33 @@ package models
 
 import (
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Solution of the board Hash. Bound is how many times longer than optimal
+// Path may be, Optimal is set when it is 1. Nodes counts the nodes expanded
+// by the solver of version SolverVersion, and PeakMemory is the highest heap
+// of the process while it ran, in bytes. A board has one solution per
+// disposition
 type Solution struct {
 	gorm.Model
 	Size int `json:"size"`
-	Hash string `json:"hash"`
+	Hash string `json:"hash" gorm:"uniqueIndex:idx_solutions_board"`
 	Solvable bool `json:"solvable"`
 	Path string `json:"path"`
 	Length int `json:"length"`
 	Algo string `json:"algo"`
 	Workers int `json:"workers"`
 	Split int `json:"split"`
-	Disposition string `json:"disposition"`
+	Disposition string `json:"disposition" gorm:"uniqueIndex:idx_solutions_board"`
 	ComputeMs int64 `json:"computeMs"`
+	Bound float64 `json:"bound" gorm:"default:1"`
+	Indexed bool `json:"indexed" gorm:"index"`
+	Heuristic string `json:"heuristic"`
+	Nodes int `json:"nodes"`
+	PeakMemory uint64 `json:"peakMemory"`
+	Optimal bool `json:"optimal"`
+	SolverVersion string `json:"solverVersion"`
 }
 
 func (solution *Solution) GetSolutions(db *gorm.DB)(*[]Solution, error) {
@@ -54,8 +67,54 @@ func (solution *Solution) GetSolutionByHash(db *gorm.DB, hash string, dispositio
 	return db.Model(&Solution{}).Where("hash = ?", hash).Where("disposition = ?", disposition).First(solution).Error
 }
 
+// Calls fx on every solution, read by batches of size batch, until fx fails
+func ForEachSolution(db *gorm.DB, batch int, fx func(solution *Solution) error) error {
+	var solutions []Solution
+	return db.Model(&Solution{}).Order("id").FindInBatches(&solutions, batch, func(tx *gorm.DB, _ int) error {
+		for i := range solutions {
+			if err := fx(&solutions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// Solutions whose path is not yet in the index of SolutionState
+func GetUnindexedSolutions(db *gorm.DB, limit int) ([]Solution, error) {
+	var solutions []Solution
+	err := db.Model(&Solution{}).Where("indexed = ?", false).Order("id").Limit(limit).Find(&solutions).Error
+	return solutions, err
+}
+
+func (solution *Solution) SetIndexed(db *gorm.DB) error {
+	solution.Indexed = true
+	return db.Model(solution).Update("indexed", true).Error
+}
+
+// Columns replaced when a better solution of a stored board is saved
+var solutionColumns = []string{"updated_at", "deleted_at", "size", "solvable", "path", "length", "algo", "workers", "split", "compute_ms", "bound", "indexed", "heuristic", "nodes", "peak_memory", "optimal", "solver_version"}
+
+// Saves the solution in one statement, so that concurrent saves of a board
+// keep a single row. A stored solution is only replaced when deleted, not
+// optimal or longer. The solution then holds the stored row
 func (solution *Solution) UpdateOrCreateSolution(db *gorm.DB) error {
-	return db.Save(solution).Error
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}, {Name: "disposition"}},
+		DoUpdates: clause.AssignmentColumns(solutionColumns),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+			SQL: "solutions.deleted_at IS NOT NULL OR NOT solutions.optimal OR excluded.length < solutions.length",
+		}}},
+	}).Create(solution).Error
+	if err != nil {
+		return err
+	}
+	stored := Solution{}
+	if err := stored.GetSolutionByHash(db, solution.Hash, solution.Disposition); err != nil {
+		return err
+	}
+	*solution = stored
+	return nil
 }
 
 func (solution *Solution) DeleteSolution(db *gorm.DB, id uint) error {
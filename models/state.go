@@ -0,0 +1,38 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Board met along the path of a stored solution : the moves of the solution
+// from Offset on solve it. Hash is the representative of the board, reached
+// from the board by the symmetry named Symmetry
+type SolutionState struct {
+	ID          uint   `json:"id" gorm:"primarykey"`
+	Hash        string `json:"hash" gorm:"uniqueIndex:idx_solution_states_board"`
+	Disposition string `json:"disposition" gorm:"uniqueIndex:idx_solution_states_board"`
+	SolutionID  uint   `json:"solutionId"`
+	Offset      int    `json:"offset"`
+	Symmetry    string `json:"symmetry"`
+}
+
+func (state *SolutionState) GetStateByHash(db *gorm.DB, hash string, disposition string) error {
+	res := db.Model(&SolutionState{}).Where("hash = ?", hash).Where("disposition = ?", disposition).Limit(1).Find(state)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+func DeleteStatesOfSolution(db *gorm.DB, solutionID uint) error {
+	return db.Where("solution_id = ?", solutionID).Delete(&SolutionState{}).Error
+}
+
+// Boards already indexed keep the state found first
+func CreateStates(db *gorm.DB, states []SolutionState) error {
+	if len(states) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(states, 100).Error
+}
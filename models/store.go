@@ -0,0 +1,35 @@
+package models
+
+import "gorm.io/gorm"
+
+// Returned by the Get methods of a store when nothing matches
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// Storage of the solutions, one per board and disposition, and of the index
+// of the boards met along their paths. Get methods fill their first
+// argument
+type SolutionStore interface {
+	GetByHash(solution *Solution, hash string, disposition string) error
+	GetByID(solution *Solution, id uint) error
+	GetRandomBySize(solution *Solution, size int) error
+	Count() (int64, error)
+	CountBySize(size int) (int64, error)
+	// Saves the solution unless the stored solution of its board is optimal
+	// and as short. The solution then holds the stored one
+	Save(solution *Solution) error
+	// Deletes the solution and its states
+	Delete(id uint) error
+	// Lists the solutions in the order of their ids, calling fx on each until
+	// it fails. The store reads them by batches of size batch
+	List(batch int, fx func(solution *Solution) error) error
+
+	GetState(state *SolutionState, hash string, disposition string) error
+	// Replaces the states of the solution with states and marks it indexed.
+	// Boards already indexed keep the state found first
+	IndexSolution(solution *Solution, states []SolutionState) error
+	// Solutions whose path is not yet indexed, oldest first
+	GetUnindexed(limit int) ([]Solution, error)
+
+	// Writes what the store holds and releases it
+	Close() error
+}